@@ -0,0 +1,86 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Agent provides signers from a running ssh-agent, including keys held by hardware
+// tokens exposed through the agent.  The agent connection is opened on the first call
+// to Signers and re-established if it fails.  An Agent is safe for concurrent use.
+type Agent struct {
+	socket string
+
+	m      sync.Mutex // protects conn and client
+	conn   net.Conn
+	client agent.ExtendedAgent
+}
+
+// NewAgent returns an Agent for the ssh-agent listening on the unix socket.  If socket
+// is empty, the SSH_AUTH_SOCK environment variable is used.
+func NewAgent(socket string) *Agent {
+	return &Agent{socket: socket}
+}
+
+// AuthMethod returns an ssh.AuthMethod that authenticates with the agent's keys.
+// Use it in the ssh.ClientConfig passed to New.
+func (a *Agent) AuthMethod() ssh.AuthMethod {
+	return ssh.PublicKeysCallback(a.Signers)
+}
+
+// Signers returns the agent's current signers.  Signers use the agent connection
+// to sign, so they become invalid after Close.
+func (a *Agent) Signers() ([]ssh.Signer, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	if a.client != nil {
+		signers, err := a.client.Signers()
+		if err == nil {
+			return signers, nil
+		}
+		// agent connection failed, so reconnect
+		a.conn.Close()
+		a.conn, a.client = nil, nil
+	}
+	socket := a.socket
+	if socket == "" {
+		if socket = os.Getenv("SSH_AUTH_SOCK"); socket == "" {
+			return nil, errors.New("ssh agent socket not specified and SSH_AUTH_SOCK not set")
+		}
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	client := agent.NewClient(conn)
+	signers, err := client.Signers()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	a.conn, a.client = conn, client
+	return signers, nil
+}
+
+// Close closes the agent connection.  A later call to Signers
+// reconnects.
+func (a *Agent) Close() error {
+	a.m.Lock()
+	defer a.m.Unlock()
+	if a.conn == nil {
+		return nil
+	}
+	err := a.conn.Close()
+	a.conn, a.client = nil, nil
+	return err
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jfcote87/sshdb"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestAgent(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9249", "localhost:9250"
+	clientSigner, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	clientKey, err := ssh.ParseRawPrivateKeyWithPassphrase([]byte(clientPrivateKey), []byte("sshdb_example"))
+	if err != nil {
+		t.Errorf("unable to parse raw key - %v", err)
+		return
+	}
+	socket, agentConns, closeAgent, err := startAgent(t.TempDir(), clientKey)
+	if err != nil {
+		t.Errorf("agent start %v", err)
+		return
+	}
+	defer closeAgent()
+
+	ds := &directTCPServer{
+		signer: serverSigner,
+		userID: "me",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: &ssh.ServerConfig{
+			PublicKeyCallback: func(meta ssh.ConnMetadata, pk ssh.PublicKey) (*ssh.Permissions, error) {
+				if meta.User() != "me" || !bytes.Equal(pk.Marshal(), clientSigner.PublicKey().Marshal()) {
+					return nil, errors.New("invalid key")
+				}
+				return &ssh.Permissions{}, nil
+			},
+		},
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("New", func(t *testing.T) {
+		ag := sshdb.NewAgent(socket)
+		defer ag.Close()
+		tunnel, err := sshdb.New(&ssh.ClientConfig{
+			User:            "me",
+			Auth:            []ssh.AuthMethod{ag.AuthMethod()},
+			HostKeyCallback: ssh.FixedHostKey(serverSigner.PublicKey()),
+		}, remoteAddr)
+		if err != nil {
+			t.Errorf("new tunnel %v", err)
+			return
+		}
+		defer tunnel.Close()
+		conn, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+		if err != nil {
+			t.Errorf("dial failed %v", err)
+			return
+		}
+		defer conn.Close()
+		if err := echoTest(conn); err != nil {
+			t.Errorf("echo %v", err)
+		}
+	})
+	t.Run("TunnelConfig", func(t *testing.T) {
+		cfg := &sshdb.TunnelConfig{
+			HostPort:        remoteAddr,
+			UserID:          "me",
+			Pwd:             "wrongpassword",
+			AgentSocket:     socket,
+			ServerPublicKey: string(ssh.MarshalAuthorizedKey(serverSigner.PublicKey())),
+			Forwards: map[string]sshdb.ForwardConfig{
+				"db": {LocalAddr: "127.0.0.1:0", RemoteAddr: remoteDbAddr},
+			},
+		}
+		forwarders, err := cfg.OpenForwards(ctx)
+		if err != nil {
+			t.Errorf("open forwards failed %v", err)
+			return
+		}
+		defer cfg.Close()
+		conn, err := net.Dial("tcp", forwarders["db"].Addr().String())
+		if err != nil {
+			t.Errorf("dial forwarder failed %v", err)
+			return
+		}
+		defer conn.Close()
+		if err := echoTest(conn); err != nil {
+			t.Errorf("echo %v", err)
+		}
+		// Close must release the agent connection
+		if err := cfg.Close(); err != nil {
+			t.Errorf("close %v", err)
+		}
+		for i := 0; i < 50 && agentConns() > 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if cnt := agentConns(); cnt != 0 {
+			t.Errorf("expected 0 agent connections after Close; got %d", cnt)
+		}
+	})
+	t.Run("NoSocket", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "")
+		if _, err := sshdb.NewAgent("").Signers(); err == nil {
+			t.Errorf("expected missing socket error")
+		}
+	})
+}
+
+// startAgent serves an in-memory keyring containing key on a
+// unix socket in dir.  The returned func reports the number of open
+// agent connections.
+func startAgent(dir string, key interface{}) (string, func() int32, func(), error) {
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		return "", nil, nil, err
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var conns int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go func() {
+				defer atomic.AddInt32(&conns, -1)
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return socket, func() int32 { return atomic.LoadInt32(&conns) }, func() { l.Close() }, nil
+}
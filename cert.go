@@ -0,0 +1,68 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostCertCallback returns an ssh.HostKeyCallback that accepts host certificates
+// signed by one of caKeys.  The certificate must be a host certificate that lists
+// the dialed host name as a principal and must be within its validity period.  Host
+// keys that are not certificates are passed to fallback, and are rejected if
+// fallback is nil.
+func HostCertCallback(caKeys []ssh.PublicKey, fallback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+			return containsKey(caKeys, auth)
+		},
+		HostKeyFallback: fallback,
+	}
+	return checker.CheckHostKey
+}
+
+// containsKey reports whether key is in keys
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	b := key.Marshal()
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), b) {
+			return true
+		}
+	}
+	return false
+}
+
+var errNotCertificate = errors.New("key is not a certificate")
+
+// parseCert parses an authorized_keys formatted certificate
+func parseCert(b []byte) (*ssh.Certificate, error) {
+	pub, err := parsePubKey(b)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errNotCertificate
+	}
+	return cert, nil
+}
+
+// parsePubKeys parses each authorized_keys formatted key in b
+func parsePubKeys(b []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(b)) > 0 {
+		k, _, _, rest, err := ssh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		b = rest
+	}
+	return keys, nil
+}
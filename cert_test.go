@@ -0,0 +1,187 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jfcote87/sshdb"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestTunnelConfig_Certificates(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9251", "localhost:9252"
+	clientSigner, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	userCA, hostCA := newSigner(), newSigner()
+	if userCA == nil || hostCA == nil {
+		t.Errorf("unable to generate ca keys")
+		return
+	}
+	validBefore := time.Now().Add(time.Hour)
+	userCert, err := signCert(userCA, clientSigner.PublicKey(), ssh.UserCert, []string{"me"}, validBefore)
+	if err != nil {
+		t.Errorf("user cert %v", err)
+		return
+	}
+	hostCert, err := signCert(hostCA, serverSigner.PublicKey(), ssh.HostCert, []string{"localhost"}, validBefore)
+	if err != nil {
+		t.Errorf("host cert %v", err)
+		return
+	}
+	hostCertSigner, err := ssh.NewCertSigner(hostCert, serverSigner)
+	if err != nil {
+		t.Errorf("host cert signer %v", err)
+		return
+	}
+	userChecker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), userCA.PublicKey().Marshal())
+		},
+	}
+	ds := &directTCPServer{
+		signer: hostCertSigner,
+		userID: "me",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: &ssh.ServerConfig{PublicKeyCallback: userChecker.Authenticate},
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+
+	hostCAKey := string(ssh.MarshalAuthorizedKey(hostCA.PublicKey()))
+	tests := []struct {
+		name       string
+		clientCert string
+		caKeys     []string
+		wantErr    bool
+	}{
+		{name: "valid", clientCert: string(ssh.MarshalAuthorizedKey(userCert)), caKeys: []string{hostCAKey}},
+		{name: "no_client_cert", caKeys: []string{hostCAKey}, wantErr: true},
+		{name: "wrong_ca", clientCert: string(ssh.MarshalAuthorizedKey(userCert)),
+			caKeys: []string{string(ssh.MarshalAuthorizedKey(userCA.PublicKey()))}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &sshdb.TunnelConfig{
+				HostPort:     remoteAddr,
+				UserID:       "me",
+				ClientKey:    clientPrivateKey,
+				ClientKeyPwd: "sshdb_example",
+				ClientCert:   tt.clientCert,
+				ServerCAKeys: tt.caKeys,
+				Forwards: map[string]sshdb.ForwardConfig{
+					"db": {LocalAddr: "127.0.0.1:0", RemoteAddr: remoteDbAddr},
+				},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			forwarders, err := cfg.OpenForwards(ctx)
+			if err != nil {
+				t.Errorf("open forwards failed %v", err)
+				return
+			}
+			defer forwarders["db"].Close()
+			tunnel := sshdb.ForwarderTunnel(forwarders["db"])
+			defer tunnel.Close()
+			conn, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+			if tt.wantErr {
+				if err == nil {
+					conn.Close()
+					t.Errorf("expected connection error")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("dial failed %v", err)
+				return
+			}
+			defer conn.Close()
+			if err := echoTest(conn); err != nil {
+				t.Errorf("echo %v", err)
+			}
+		})
+	}
+}
+
+func TestHostCertCallback(t *testing.T) {
+	_, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	hostCA := newSigner()
+	now := time.Now()
+	valid, _ := signCert(hostCA, serverSigner.PublicKey(), ssh.HostCert, []string{"db.example.com"}, now.Add(time.Hour))
+	expired, _ := signCert(hostCA, serverSigner.PublicKey(), ssh.HostCert, []string{"db.example.com"}, now.Add(-time.Hour))
+	userCert, _ := signCert(hostCA, serverSigner.PublicKey(), ssh.UserCert, []string{"db.example.com"}, now.Add(time.Hour))
+	otherCA, _ := signCert(newSigner(), serverSigner.PublicKey(), ssh.HostCert, []string{"db.example.com"}, now.Add(time.Hour))
+
+	caKeys := []ssh.PublicKey{newSigner().PublicKey(), hostCA.PublicKey()}
+	remote := &net.TCPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 22}
+	tests := []struct {
+		name     string
+		addr     string
+		key      ssh.PublicKey
+		fallback ssh.HostKeyCallback
+		wantErr  bool
+	}{
+		{name: "valid", addr: "db.example.com:22", key: valid},
+		{name: "valid_port", addr: "db.example.com:2222", key: valid},
+		{name: "principal", addr: "other.example.com:22", key: valid, wantErr: true},
+		{name: "expired", addr: "db.example.com:22", key: expired, wantErr: true},
+		{name: "user_cert", addr: "db.example.com:22", key: userCert, wantErr: true},
+		{name: "unknown_ca", addr: "db.example.com:22", key: otherCA, wantErr: true},
+		{name: "no_fallback", addr: "db.example.com:22", key: serverSigner.PublicKey(), wantErr: true},
+		{name: "fallback", addr: "db.example.com:22", key: serverSigner.PublicKey(),
+			fallback: ssh.FixedHostKey(serverSigner.PublicKey())},
+	}
+	for _, tt := range tests {
+		err := sshdb.HostCertCallback(caKeys, tt.fallback)(tt.addr, remote, tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s expected error = %v; got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+// newSigner returns a signer for a new ed25519 key
+func newSigner() ssh.Signer {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	signer, err := ssh.NewSignerFromKey(pk)
+	if err != nil {
+		return nil
+	}
+	return signer
+}
+
+// signCert creates a certificate for key signed by ca
+func signCert(ca ssh.Signer, key ssh.PublicKey, certType uint32, principals []string, validBefore time.Time) (*ssh.Certificate, error) {
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        certType,
+		KeyId:           "sshdb_test",
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(validBefore.Add(-2 * time.Hour).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	return cert, cert.SignCert(rand.Reader, ca)
+}
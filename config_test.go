@@ -12,6 +12,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/jfcote87/sshdb"
 	"gopkg.in/yaml.v3"
@@ -46,6 +47,24 @@ func TestTunnelConfig(t *testing.T) {
 		{name: "fail17", hasErr: true, errIdx: 10},
 		{name: "fail18", hasErr: true, errIdx: 13},
 		{name: "success19", numDB: 3},
+		{name: "success20", numDB: 1},
+		{name: "fail21", hasErr: true, errIdx: 1},
+		{name: "fail22", hasErr: true, errIdx: 9},
+		{name: "success23", numDB: 1},
+		{name: "success24", numDB: 0},
+		{name: "fail25", hasErr: true, errIdx: 22},
+		{name: "fail26", hasErr: true, errIdx: 24},
+		{name: "success27", numDB: 1},
+		{name: "success28", numDB: 1},
+		{name: "fail29", hasErr: true, errIdx: 26},
+		{name: "fail30", hasErr: true, errIdx: 28},
+		{name: "fail31", hasErr: true, errIdx: 30},
+		{name: "fail32", hasErr: true, errIdx: 31},
+		{name: "fail33", hasErr: true, errIdx: 32},
+		{name: "fail34", hasErr: true, errIdx: 33},
+		{name: "fail35", hasErr: true, errIdx: 35},
+		{name: "success36", numDB: 1},
+		{name: "success37", numDB: 2},
 	}
 	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -70,6 +89,9 @@ func TestTunnelConfig(t *testing.T) {
 			if err != nil {
 				t.Errorf("%s expected success; got %v", tt.name, err)
 			}
+			if cfg.KeepaliveInterval > 0 && time.Duration(cfg.KeepaliveInterval) != 15*time.Second {
+				t.Errorf("%s expected keepalive interval of 15s; got %v", tt.name, time.Duration(cfg.KeepaliveInterval))
+			}
 			if len(dbs) != tt.numDB {
 				t.Errorf("%s expected %d dbs; got %d", tt.name, tt.numDB, len(dbs))
 			}
@@ -137,3 +159,97 @@ func TestConfigError(t *testing.T) {
 		t.Errorf("expected msg %s; got %s", expectedMsg, xerr.Error())
 	}
 }
+
+func TestTunnelConfig_CloseReopen(t *testing.T) {
+	sshdb.RegisterDriver("test_driver", testDriver)
+	cfg, err := getTunnelConfig("testfiles/config/test19.yaml")
+	if err != nil {
+		t.Errorf("config file load failed %v", err)
+		return
+	}
+	db, err := cfg.DB("valid00")
+	if err != nil {
+		t.Errorf("DB %v", err)
+		return
+	}
+	tun, err := cfg.Tunnel()
+	if err != nil || tun == nil {
+		t.Errorf("Tunnel expected tunnel; got %v", err)
+		return
+	}
+	if err := cfg.Close(); err != nil {
+		t.Errorf("Close %v", err)
+	}
+	if err := db.Ping(); err == nil || err.Error() != "sql: database is closed" {
+		t.Errorf("expected closed database; got %v", err)
+	}
+	var ce *sshdb.ConfigError
+	if _, err := cfg.DB("valid00"); !errors.As(err, &ce) || ce.Idx != 39 {
+		t.Errorf("expected ConfigError 39 from DB; got %v", err)
+	}
+	if _, err := cfg.Tunnel(); !errors.As(err, &ce) || ce.Idx != 39 {
+		t.Errorf("expected ConfigError 39 from Tunnel; got %v", err)
+	}
+
+	cfg.Datasources["valid03"] = sshdb.Datasource{DriverName: "test_driver", ConnectionString: "valid_dsn_string4"}
+	if err := cfg.Reopen(); err != nil {
+		t.Errorf("Reopen %v", err)
+		return
+	}
+	defer cfg.Close()
+	if dbs, err := cfg.DatabaseMap(); err != nil || len(dbs) != 4 || dbs["valid00"] == db {
+		t.Errorf("expected 4 new dbs after Reopen; got %d %v", len(dbs), err)
+	}
+	if tun2, err := cfg.Tunnel(); err != nil || tun2 == tun {
+		t.Errorf("expected new tunnel after Reopen; got %v", err)
+	}
+}
+
+func TestTunnelConfig_DatabaseMapError(t *testing.T) {
+	sshdb.RegisterDriver("test_driver", testDriver)
+	cfg := &sshdb.TunnelConfig{
+		HostPort: "ssh.example.com:22",
+		UserID:   "me",
+		Pwd:      "good_password",
+		Datasources: map[string]sshdb.Datasource{
+			"valid":     {DriverName: "test_driver", ConnectionString: "valid_dsn_string"},
+			"baddriver": {DriverName: "bad_driver", ConnectionString: "valid_dsn"},
+		},
+	}
+	defer cfg.Close()
+	// a failed DatabaseMap must not leave a partial map for later calls
+	for i := 0; i < 2; i++ {
+		var ce *sshdb.ConfigError
+		if dbs, err := cfg.DatabaseMap(); !errors.As(err, &ce) || ce.Idx != 12 || dbs != nil {
+			t.Errorf("call %d expected ConfigError 12 and no dbs; got %d %v", i, len(dbs), err)
+		}
+	}
+}
+
+func TestTunnelConfig_PoolSettings(t *testing.T) {
+	sshdb.RegisterDriver("test_driver", testDriver)
+	cfg, err := getTunnelConfig("testfiles/config/test37.yaml")
+	if err != nil {
+		t.Errorf("config file load failed %v", err)
+		return
+	}
+	defer cfg.Close()
+	if cfg.MaxChannels != 8 {
+		t.Errorf("expected max_channels 8; got %d", cfg.MaxChannels)
+	}
+	ds := cfg.Datasources["pooled"]
+	if ds.MaxIdleConns != 2 || time.Duration(ds.ConnMaxLifetime) != 5*time.Minute || time.Duration(ds.ConnMaxIdleTime) != time.Minute {
+		t.Errorf("unexpected pool settings %#v", ds)
+	}
+	tests := map[string]int{"pooled": 4, "default": 0}
+	for nm, maxOpen := range tests {
+		db, err := cfg.DB(nm)
+		if err != nil {
+			t.Errorf("%s DB %v", nm, err)
+			continue
+		}
+		if stats := db.Stats(); stats.MaxOpenConnections != maxOpen {
+			t.Errorf("%s expected MaxOpenConnections %d; got %d", nm, maxOpen, stats.MaxOpenConnections)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sync"
+)
+
+// ConnectorOptions are per datasource connector settings.  The dialer wrapper
+// applies to all drivers while other options require an OptionsDriver.
+//
+//	datasources:
+//	  orders:
+//	    driver_name: mssql
+//	    dsn: sqlserver://app:${env:ORDERS_PWD}@orders.internal?database=orders
+//	    connector_options:
+//	      session_init_sql: SET ANSI_NULLS ON
+//	      dialer_wrapper: metrics
+type ConnectorOptions struct {
+	// sql run at the start of each new connection
+	SessionInitSQL string `yaml:"session_init_sql,omitempty" json:"session_init_sql,omitempty"`
+	// name of a DialerWrapper registered with RegisterDialerWrapper
+	DialerWrapper string `yaml:"dialer_wrapper,omitempty" json:"dialer_wrapper,omitempty"`
+	// wraps the tunnel's dialer when set in code.  Takes precedence
+	// over DialerWrapper.
+	WrapDialer DialerWrapper `yaml:"-" json:"-"`
+}
+
+// isZero reports whether no options are set
+func (co *ConnectorOptions) isZero() bool {
+	return co == nil || (co.SessionInitSQL == "" && co.DialerWrapper == "" && co.WrapDialer == nil)
+}
+
+// driverOptions reports whether options other than the dialer wrapper are set
+func (co *ConnectorOptions) driverOptions() bool {
+	return co != nil && co.SessionInitSQL > ""
+}
+
+// wrapper returns the DialerWrapper for the options or nil if none is set
+func (co *ConnectorOptions) wrapper() (DialerWrapper, error) {
+	switch {
+	case co == nil:
+		return nil, nil
+	case co.WrapDialer != nil:
+		return co.WrapDialer, nil
+	case co.DialerWrapper == "":
+		return nil, nil
+	}
+	w := dialerWrapper(co.DialerWrapper)
+	if w == nil {
+		return nil, fmt.Errorf("no dialer wrapper registered as %s", co.DialerWrapper)
+	}
+	return w, nil
+}
+
+// OptionsDriver is a Driver that accepts ConnectorOptions.  The dialer passed
+// to OpenConnectorWithOptions has already been wrapped.
+type OptionsDriver interface {
+	Driver
+	OpenConnectorWithOptions(dialer Dialer, dsn string, opts ConnectorOptions) (driver.Connector, error)
+}
+
+// DSNValidator is a Driver that checks a dsn without creating a connector.
+// TunnelConfig.Validate calls ValidateDSN rather than OpenConnector, so
+// drivers whose OpenConnector registers global state should implement it.
+type DSNValidator interface {
+	Driver
+	ValidateDSN(dsn string) error
+}
+
+// DialerWrapper returns a Dialer that wraps the tunnel's dialer, e.g. to
+// record metrics or set deadlines.
+type DialerWrapper func(Dialer) Dialer
+
+var dialerWrappers = make(map[string]DialerWrapper)
+var mDialerWrappers sync.Mutex
+
+// RegisterDialerWrapper associates a DialerWrapper with name so that
+// datasources may select it using the dialer_wrapper connector option.
+func RegisterDialerWrapper(name string, w DialerWrapper) {
+	mDialerWrappers.Lock()
+	dialerWrappers[name] = w
+	mDialerWrappers.Unlock()
+}
+
+func dialerWrapper(name string) DialerWrapper {
+	mDialerWrappers.Lock()
+	defer mDialerWrappers.Unlock()
+	return dialerWrappers[name]
+}
+
+// openConnector wraps dialer and passes the options to tunnelDriver
+func openConnector(tunnelDriver Driver, dialer Dialer, dsn string, opts *ConnectorOptions) (driver.Connector, error) {
+	w, err := opts.wrapper()
+	if err != nil {
+		return nil, err
+	}
+	if w != nil {
+		dialer = w(dialer)
+	}
+	if od, ok := tunnelDriver.(OptionsDriver); ok && opts != nil {
+		return od.OpenConnectorWithOptions(dialer, dsn, *opts)
+	}
+	if opts.driverOptions() {
+		return nil, fmt.Errorf("driver %s does not support connector options", tunnelDriver.Name())
+	}
+	return tunnelDriver.OpenConnector(dialer, dsn)
+}
+
+// OpenConnectorWithOptions returns a new connector that uses the options.  Unlike
+// OpenConnector, the connector is not shared with other callers unless opts is
+// empty.
+func (tun *Tunnel) OpenConnectorWithOptions(tunnelDriver Driver, dataSourceName string, opts ConnectorOptions) (driver.Connector, error) {
+	if opts.isZero() {
+		return tun.OpenConnector(tunnelDriver, dataSourceName)
+	}
+	return openConnector(tunnelDriver, DialerFunc(tun.DialContext), dataSourceName, &opts)
+}
+
+// connectorOptionsErr checks the connector options of the datasource nm
+func (tc *TunnelConfig) connectorOptionsErr(nm string, ds Datasource, tunnelDriver Driver) *ConfigError {
+	if _, err := ds.ConnectorOptions.wrapper(); err != nil {
+		return tc.newErr(ErrConnectorOptions, "datasources."+nm+".connector_options.dialer_wrapper", ds.ConnectionString, fmt.Sprintf("[%s] %v", nm, err)).setErr(err)
+	}
+	if _, ok := tunnelDriver.(OptionsDriver); !ok && ds.ConnectorOptions.driverOptions() {
+		return tc.newErr(ErrConnectorOptions, "datasources."+nm+".connector_options", ds.ConnectionString, fmt.Sprintf("[%s] driver %s does not support connector options", nm, ds.DriverName))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jfcote87/sshdb"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// optionsDriver records the options passed by the tunnel
+type optionsDriver struct {
+	tunDriver
+	opts []sshdb.ConnectorOptions
+}
+
+func (od *optionsDriver) OpenConnectorWithOptions(dialer sshdb.Dialer, dsn string, opts sshdb.ConnectorOptions) (driver.Connector, error) {
+	od.opts = append(od.opts, opts)
+	return od.OpenConnector(dialer, dsn)
+}
+
+var errWrapped = errors.New("wrapped dialer")
+
+// wrapDialer returns a dialer that fails with errWrapped
+func wrapDialer(cnt *int) sshdb.DialerWrapper {
+	return func(d sshdb.Dialer) sshdb.Dialer {
+		*cnt++
+		return sshdb.DialerFunc(func(context.Context, string, string) (net.Conn, error) {
+			return nil, errWrapped
+		})
+	}
+}
+
+const connectorOptionsYAML = `
+hostport: localhost:9263
+user_id: me
+pwd: good_password
+datasources:
+  plain:
+    driver_name: test_driver
+    dsn: valid_dsn_string
+  wrapped:
+    driver_name: test_driver
+    dsn: valid_dsn_string
+    connector_options:
+      dialer_wrapper: test_wrapper
+  session:
+    driver_name: test_options_driver
+    dsn: valid_dsn_string
+    connector_options:
+      session_init_sql: SET ANSI_NULLS ON
+`
+
+func TestTunnelConfig_ConnectorOptions(t *testing.T) {
+	var wrapCnt int
+	od := &optionsDriver{tunDriver: "test_options_driver"}
+	sshdb.RegisterDriver("test_driver", testDriver)
+	sshdb.RegisterDriver("test_options_driver", od)
+	sshdb.RegisterDialerWrapper("test_wrapper", wrapDialer(&wrapCnt))
+
+	var tc *sshdb.TunnelConfig
+	if err := yaml.Unmarshal([]byte(connectorOptionsYAML), &tc); err != nil {
+		t.Fatalf("yaml decode %v", err)
+	}
+	if err := tc.Validate(); err != nil {
+		t.Fatalf("Validate %v", err)
+	}
+	wrapCnt, od.opts = 0, nil
+	dbs, err := tc.DatabaseMap()
+	if err != nil {
+		t.Fatalf("DatabaseMap %v", err)
+	}
+	defer tc.Close()
+	if len(dbs) != 3 || wrapCnt != 1 {
+		t.Errorf("expected 3 dbs and 1 wrapped dialer; got %d dbs and %d wrapped", len(dbs), wrapCnt)
+	}
+	if len(od.opts) != 1 || od.opts[0].SessionInitSQL != "SET ANSI_NULLS ON" {
+		t.Errorf("expected session_init_sql passed to driver; got %#v", od.opts)
+	}
+
+	for _, tt := range []struct {
+		name string
+		ds   sshdb.Datasource
+		path string
+	}{
+		{name: "unregistered wrapper", path: "datasources.x.connector_options.dialer_wrapper",
+			ds: sshdb.Datasource{DriverName: "test_driver", ConnectionString: "dsn", ConnectorOptions: &sshdb.ConnectorOptions{DialerWrapper: "none"}}},
+		{name: "unsupported option", path: "datasources.x.connector_options",
+			ds: sshdb.Datasource{DriverName: "test_driver", ConnectionString: "dsn", ConnectorOptions: &sshdb.ConnectorOptions{SessionInitSQL: "SELECT 1"}}},
+	} {
+		tcx := &sshdb.TunnelConfig{HostPort: "localhost:9263", UserID: "me", Pwd: "pwd", Datasources: map[string]sshdb.Datasource{"x": tt.ds}}
+		err := tcx.Validate()
+		var errs sshdb.ConfigErrors
+		if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Code() != sshdb.ErrConnectorOptions || errs[0].Path != tt.path {
+			t.Errorf("%s: Validate expected ErrConnectorOptions at %s; got %v", tt.name, tt.path, err)
+		}
+		if _, err := tcx.DatabaseMap(); !errors.Is(err, sshdb.ErrConnectorOptions) {
+			t.Errorf("%s: DatabaseMap expected ErrConnectorOptions; got %v", tt.name, err)
+		}
+	}
+}
+
+func TestTunnel_OpenConnectorWithOptions(t *testing.T) {
+	tun, err := sshdb.New(&ssh.ClientConfig{User: "me", HostKeyCallback: ssh.InsecureIgnoreHostKey()}, "localhost:9263")
+	if err != nil {
+		t.Fatalf("New %v", err)
+	}
+	defer tun.Close()
+	var wrapCnt int
+	opts := sshdb.ConnectorOptions{WrapDialer: wrapDialer(&wrapCnt), DialerWrapper: "ignored"}
+	connector, err := tun.OpenConnectorWithOptions(testDriver, "valid_dsn_string", opts)
+	if err != nil {
+		t.Fatalf("OpenConnectorWithOptions %v", err)
+	}
+	c, ok := connector.(*Connector)
+	if !ok {
+		t.Fatalf("expected *Connector; got %T", connector)
+	}
+	if _, err := c.Dialer.DialContext(context.Background(), "tcp", "localhost:1433"); err != errWrapped || wrapCnt != 1 {
+		t.Errorf("expected wrapped dialer; got %v", err)
+	}
+	shared, _ := tun.OpenConnector(testDriver, "valid_dsn_string")
+	if shared == connector {
+		t.Errorf("expected connector with options not to be shared")
+	}
+	if cx, _ := tun.OpenConnectorWithOptions(testDriver, "valid_dsn_string", sshdb.ConnectorOptions{}); cx != shared {
+		t.Errorf("expected empty options to return the shared connector")
+	}
+	_, err = tun.OpenConnectorWithOptions(testDriver, "valid_dsn_string", sshdb.ConnectorOptions{SessionInitSQL: "SELECT 1"})
+	if err == nil || !strings.Contains(err.Error(), "does not support connector options") {
+		t.Errorf("expected unsupported options error; got %v", err)
+	}
+}
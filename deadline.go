@@ -0,0 +1,192 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// connDeadline is an abstraction for handling timeouts.  It follows
+// the design of the deadline handling in net.Pipe.
+type connDeadline struct {
+	mu     sync.Mutex // guards timer and cancel
+	timer  *time.Timer
+	cancel chan struct{} // must be non-nil
+}
+
+func newConnDeadline() *connDeadline {
+	return &connDeadline{cancel: make(chan struct{})}
+}
+
+// set sets the point in time when the deadline will time out.
+// A timeout event is signaled by closing the channel returned by wait.
+// Once a timeout has occurred, the deadline can be refreshed by specifying a
+// t value in the future.
+//
+// A zero value for t prevents timeout.
+func (d *connDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer callback to finish and close cancel
+	}
+	d.timer = nil
+
+	// time is zero, then there is no deadline.
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	// time in the future, setup a timer to cancel in the future.
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		d.timer = time.AfterFunc(dur, func() {
+			close(d.cancel)
+		})
+		return
+	}
+
+	// time in the past, so close immediately.
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline is exceeded.
+func (d *connDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// ioResult is returned from a background read or write
+type ioResult struct {
+	n   int
+	err error
+}
+
+// asyncIO holds the state of reads or writes performed in a background
+// go routine so that callers may return when a deadline passes.  An
+// operation that outlives its deadline is completed by the next call.
+type asyncIO struct {
+	buf     []byte        // read data or copy of write data
+	pending chan ioResult // non-nil while a background op is running
+	unread  []byte        // read data not yet returned to caller
+	err     error         // read error to return once unread is empty
+}
+
+// read fills b from the channel or returns a timeout error when the read
+// deadline passes. Callers must hold sc.mRead.
+func (sc *sshConn) read(b []byte) (int, error) {
+	r, deadline := &sc.reader, sc.readDeadline.wait()
+	if isClosedChan(deadline) {
+		return 0, sc.timeoutError("read")
+	}
+	if len(r.unread) > 0 {
+		n := copy(b, r.unread)
+		r.unread = r.unread[n:]
+		return n, nil
+	}
+	if r.err != nil {
+		err := r.err
+		r.err = nil
+		return 0, err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if r.pending == nil {
+		if cap(r.buf) < len(b) {
+			r.buf = make([]byte, len(b))
+		}
+		buf, ch := r.buf[:len(b)], make(chan ioResult, 1)
+		go func() {
+			n, err := sc.Conn.Read(buf)
+			ch <- ioResult{n, err}
+		}()
+		r.pending = ch
+	}
+	select {
+	case res := <-r.pending:
+		r.pending = nil
+		data := r.buf[:res.n]
+		n := copy(b, data)
+		if r.unread = data[n:]; len(r.unread) > 0 {
+			r.err = res.err
+			return n, nil
+		}
+		return n, res.err
+	case <-deadline:
+	}
+	return 0, sc.timeoutError("read")
+}
+
+// write sends b to the channel or returns a timeout error when the write
+// deadline passes.  The data of a timed out write may still be sent, and
+// the next write waits for it to complete.  Callers must hold sc.mWrite.
+func (sc *sshConn) write(b []byte) (int, error) {
+	w, deadline := &sc.writer, sc.writeDeadline.wait()
+	if w.pending != nil {
+		// wait for a write that exceeded a prior deadline
+		select {
+		case res := <-w.pending:
+			w.pending = nil
+			if res.err != nil {
+				return 0, res.err
+			}
+		case <-deadline:
+			return 0, sc.timeoutError("write")
+		}
+	}
+	if isClosedChan(deadline) {
+		return 0, sc.timeoutError("write")
+	}
+	// copy b as the background write may outlive this call
+	w.buf = append(w.buf[:0], b...)
+	buf, ch := w.buf, make(chan ioResult, 1)
+	go func() {
+		n, err := sc.Conn.Write(buf)
+		ch <- ioResult{n, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.n, res.err
+	case <-deadline:
+	}
+	w.buf = nil // owned by the background write
+	w.pending = ch
+	return 0, sc.timeoutError("write")
+}
+
+// timeoutError returns an os.ErrDeadlineExceeded wrapped in a *net.OpError
+func (sc *sshConn) timeoutError(op string) error {
+	return &net.OpError{
+		Op:     op,
+		Net:    "ssh",
+		Source: sc.Conn.LocalAddr(),
+		Addr:   sc.Conn.RemoteAddr(),
+		Err:    os.ErrDeadlineExceeded,
+	}
+}
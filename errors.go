@@ -0,0 +1,125 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorCode identifies the problem described by a ConfigError and is the
+// value of ConfigError.Idx.  Use errors.Is to test for a code, e.g.
+//
+//	if errors.Is(err, sshdb.ErrKeyParse) {
+type ErrorCode int
+
+// ConfigError codes
+const (
+	ErrNoAddress                ErrorCode = 0  // hostport is blank
+	ErrNoUser                   ErrorCode = 1  // user_id is blank
+	ErrNoAuthMethod             ErrorCode = 2  // no password, key, agent or keyboard-interactive method
+	ErrKeyAndKeyFile            ErrorCode = 3  // client_key and client_key_file both specified
+	ErrKeyFile                  ErrorCode = 4  // client_key_file unreadable
+	ErrKeyParse                 ErrorCode = 5  // client key invalid or wrong passphrase
+	ErrServerKeyAndKeyFile      ErrorCode = 6  // server_public_key and server_public_key_file both specified
+	ErrServerKeyFile            ErrorCode = 7  // server_public_key_file unreadable
+	ErrServerKeyParse           ErrorCode = 8  // server public key invalid
+	ErrNewTunnel                ErrorCode = 9  // tunnel creation failed
+	ErrOpenConnector            ErrorCode = 10 // driver rejected the dsn
+	ErrDriver                   ErrorCode = 12 // driver_name not registered
+	ErrEmptyDSN                 ErrorCode = 13 // dsn is blank
+	ErrNoDatasources            ErrorCode = 20 // no datasources or forwards
+	ErrDatasourceNotFound       ErrorCode = 21 // DB name not in the TunnelConfig
+	ErrForwardAddress           ErrorCode = 22 // forward missing local_addr or remote_addr
+	ErrForwardListen            ErrorCode = 23 // forward unable to listen
+	ErrProxyURL                 ErrorCode = 24 // proxy_url invalid
+	ErrCertAndCertFile          ErrorCode = 25 // client_cert and client_cert_file both specified
+	ErrCertWithoutKey           ErrorCode = 26 // client certificate without a client key
+	ErrCertFile                 ErrorCode = 27 // client_cert_file unreadable
+	ErrCertParse                ErrorCode = 28 // client certificate invalid or not matching the key
+	ErrCAKeyFile                ErrorCode = 29 // server_ca_key_file unreadable
+	ErrCAKeyParse               ErrorCode = 30 // server ca key invalid
+	ErrTrustOnFirstUse          ErrorCode = 31 // trust_on_first_use without known_hosts_file or with a server key or ca keys
+	ErrStrictHostKey            ErrorCode = 32 // strict_host_key_checking without a host key policy
+	ErrKnownHosts               ErrorCode = 33 // known_hosts_file unreadable or invalid
+	ErrSSHConfig                ErrorCode = 34 // ssh_config_host lookup failed
+	ErrKeyboardInteractive      ErrorCode = 35 // keyboard_interactive settings invalid
+	ErrTunnelNotFound           ErrorCode = 36 // tunnel name not in the Config
+	ErrConfigDatasourceNotFound ErrorCode = 37 // datasource name not in any tunnel of the Config
+	ErrAmbiguousDatasource      ErrorCode = 38 // datasource name found in several tunnels of the Config
+	ErrClosed                   ErrorCode = 39 // TunnelConfig closed
+	ErrSecret                   ErrorCode = 40 // secret reference unresolved
+	ErrConnectorOptions         ErrorCode = 41 // connector options invalid for the driver
+)
+
+// Error returns a description of the code
+func (ec ErrorCode) Error() string {
+	return fmt.Sprintf("sshdb config error %d", int(ec))
+}
+
+// Is reports whether target is the ErrorCode of the ConfigError
+func (ce *ConfigError) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && int(code) == ce.Idx
+}
+
+// Code returns the ErrorCode of the ConfigError
+func (ce *ConfigError) Code() ErrorCode {
+	return ErrorCode(ce.Idx)
+}
+
+// ConfigErrors lists every problem found by Validate.
+type ConfigErrors []*ConfigError
+
+// Error returns the messages of each ConfigError
+func (ce ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(ce))
+	for _, e := range ce {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the ConfigErrors as a slice of errors
+func (ce ConfigErrors) Unwrap() []error {
+	errs := make([]error, 0, len(ce))
+	for _, e := range ce {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// As finds the first ConfigError that matches target.  errors.As uses As to
+// reach the individual errors on Go versions before 1.20, which do not
+// support Unwrap() []error.
+func (ce ConfigErrors) As(target interface{}) bool {
+	for _, e := range ce {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is reports whether any ConfigError matches target
+func (ce ConfigErrors) Is(target error) bool {
+	for _, e := range ce {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Codes returns the ErrorCode of each ConfigError
+func (ce ConfigErrors) Codes() []ErrorCode {
+	codes := make([]ErrorCode, 0, len(ce))
+	for _, e := range ce {
+		codes = append(codes, e.Code())
+	}
+	return codes
+}
@@ -0,0 +1,316 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+)
+
+// Forwarder pipes each connection accepted by a local listener to a
+// remote address via a Tunnel, allowing non-Go tools such as psql or the
+// mysql cli to use the tunnel.
+type Forwarder struct {
+	tun        *Tunnel
+	l          net.Listener
+	remoteAddr string
+	ctx        context.Context // cancelled on Close to stop pending dials
+	cancel     func()
+
+	closeOnce sync.Once
+	closeErr  error
+	m         sync.Mutex
+	conns     map[net.Conn]bool // local and remote connections of active pipes
+	wg        sync.WaitGroup    // tracks accept loop and pipes
+}
+
+// Forward opens a local listener on localAddr and pipes each accepted connection
+// to remoteAddr via the tunnel's DialContext.  Addresses beginning with a '/' are
+// treated as unix sockets.  The remoteAddr must be a valid address from the remote
+// ssh server.  Connections are closed and the listener stopped when ctx is done
+// or when the Forwarder is closed.  Remote connections are included in ConnCount.
+func (tun *Tunnel) Forward(ctx context.Context, localAddr, remoteAddr string) (*Forwarder, error) {
+	var lc net.ListenConfig
+	l, err := lc.Listen(ctx, network(localAddr), localAddr)
+	if err != nil {
+		return nil, err
+	}
+	fctx, cancel := context.WithCancel(ctx)
+	f := &Forwarder{
+		tun:        tun,
+		l:          l,
+		remoteAddr: remoteAddr,
+		ctx:        fctx,
+		cancel:     cancel,
+		conns:      make(map[net.Conn]bool),
+	}
+	f.wg.Add(1)
+	go f.serve()
+	go func() {
+		<-fctx.Done()
+		f.Close()
+	}()
+	return f, nil
+}
+
+// network returns "unix" for addresses beginning with a '/'
+func network(addr string) string {
+	if len(addr) > 0 && addr[0] == '/' {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// Addr returns the local listener's address
+func (f *Forwarder) Addr() net.Addr {
+	return f.l.Addr()
+}
+
+// Close stops the listener and closes all active connections.
+func (f *Forwarder) Close() error {
+	err := f.closeListener()
+	f.cancel()
+	f.m.Lock()
+	for c := range f.conns {
+		c.Close()
+	}
+	f.m.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+// Shutdown stops the listener and waits for active connections to
+// complete.  If ctx ends first, remaining connections are closed and
+// the ctx error is returned.
+func (f *Forwarder) Shutdown(ctx context.Context) error {
+	err := f.closeListener()
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		f.cancel()
+		return err
+	case <-ctx.Done():
+	}
+	f.Close()
+	return ctx.Err()
+}
+
+func (f *Forwarder) closeListener() error {
+	f.closeOnce.Do(func() {
+		f.closeErr = f.l.Close()
+	})
+	return f.closeErr
+}
+
+// track adds conn to the active list.  Returns false if the
+// Forwarder has been closed.
+func (f *Forwarder) track(conn net.Conn) bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.ctx.Err() != nil {
+		return false
+	}
+	f.conns[conn] = true
+	return true
+}
+
+func (f *Forwarder) untrack(conns ...net.Conn) {
+	f.m.Lock()
+	for _, c := range conns {
+		delete(f.conns, c)
+	}
+	f.m.Unlock()
+}
+
+func (f *Forwarder) serve() {
+	defer f.wg.Done()
+	for {
+		local, err := f.l.Accept()
+		if err != nil {
+			return
+		}
+		if !f.track(local) {
+			local.Close()
+			return
+		}
+		f.wg.Add(1)
+		go f.pipe(local)
+	}
+}
+
+// pipe copies data between the local connection and a new
+// tunnel connection until either side closes.
+func (f *Forwarder) pipe(local net.Conn) {
+	defer f.wg.Done()
+	defer local.Close()
+	defer f.untrack(local)
+	remote, err := f.tun.DialContext(f.ctx, "tcp", f.remoteAddr)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+	if !f.track(remote) {
+		return
+	}
+	defer f.untrack(remote)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+	local.Close()
+	remote.Close()
+	<-done
+}
+
+// ListenRemote asks the ssh server to listen on addr and returns a net.Listener
+// whose accepted connections are served locally.  Addresses beginning with a '/'
+// request a unix socket on the remote server.  The remote listener is re-established
+// on the new client connection after a tunnel reset, so a fixed port should be used
+// for addr to keep the remote address stable.  While the listener is open, closing the
+// last db connection does not reset the tunnel.  The listener is closed when ctx is
+// done or by calling Close.
+func (tun *Tunnel) ListenRemote(ctx context.Context, addr string) (net.Listener, error) {
+	lctx, cancel := context.WithCancel(ctx)
+	rl := &remoteListener{
+		tun:    tun,
+		addr:   addr,
+		ctx:    lctx,
+		cancel: cancel,
+	}
+	tun.m.Lock()
+	if tun.listeners == nil {
+		tun.listeners = make(map[*remoteListener]bool)
+	}
+	tun.listeners[rl] = true
+	tun.m.Unlock()
+	if _, _, err := rl.listener(); err != nil {
+		rl.Close()
+		return nil, err
+	}
+	go func() {
+		<-lctx.Done()
+		rl.Close()
+	}()
+	return rl, nil
+}
+
+// remoteListener wraps the ssh client's listener for the tunnel's
+// current client connection.
+type remoteListener struct {
+	tun    *Tunnel
+	addr   string
+	ctx    context.Context // cancelled on Close
+	cancel func()
+
+	m         sync.Mutex // protects fields below
+	l         net.Listener
+	resetChan <-chan struct{} // reset channel of client that created l
+	lastAddr  net.Addr
+	closed    bool
+}
+
+// listener returns the current ssh listener, creating a new one if the
+// tunnel's client has been reset.
+func (rl *remoteListener) listener() (net.Listener, <-chan struct{}, error) {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+	if rl.closed {
+		return nil, nil, net.ErrClosed
+	}
+	if rl.l != nil && !isClosedChan(rl.resetChan) {
+		return rl.l, rl.resetChan, nil
+	}
+	cl, resetChan, err := rl.tun.getClient(rl.ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var l net.Listener
+	if network(rl.addr) == "unix" {
+		l, err = cl.ListenUnix(rl.addr)
+	} else {
+		l, err = cl.Listen("tcp", rl.addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	rl.l, rl.resetChan, rl.lastAddr = l, resetChan, l.Addr()
+	return l, resetChan, nil
+}
+
+// Accept waits for and returns the next connection from the remote
+// server.  Accepted connections are tracked by the tunnel.
+func (rl *remoteListener) Accept() (net.Conn, error) {
+	for {
+		l, resetChan, err := rl.listener()
+		if err != nil {
+			if rl.ctx.Err() != nil {
+				return nil, net.ErrClosed
+			}
+			return nil, err
+		}
+		conn, err := l.Accept()
+		if err == nil {
+			if conn, err = rl.tun.addConn(conn, resetChan, false); err == nil {
+				return conn, nil
+			}
+			continue
+		}
+		// client closing causes the accept error, so wait for
+		// the tunnel reset before establishing a new listener
+		select {
+		case <-resetChan:
+		case <-rl.ctx.Done():
+			return nil, net.ErrClosed
+		}
+	}
+}
+
+// Close stops the remote listener.  Connections already accepted
+// are not closed.
+func (rl *remoteListener) Close() error {
+	rl.cancel() // interrupts any handshake in listener()
+	rl.m.Lock()
+	if rl.closed {
+		rl.m.Unlock()
+		return nil
+	}
+	rl.closed = true
+	var err error
+	if rl.l != nil {
+		err = rl.l.Close()
+	}
+	rl.m.Unlock()
+
+	tun := rl.tun
+	tun.m.Lock()
+	delete(tun.listeners, rl)
+	if len(tun.listeners) == 0 && len(tun.sshconns) == 0 {
+		// no connections remain so close client
+		tun.reset()
+	}
+	tun.m.Unlock()
+	return err
+}
+
+// Addr returns the address of the remote listener
+func (rl *remoteListener) Addr() net.Addr {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+	return rl.lastAddr
+}
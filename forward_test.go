@@ -0,0 +1,418 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jfcote87/sshdb"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestTunnel_Forward(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9241", "localhost:9242"
+	_, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		userID: "me",
+		pwd:    "forwardpwd",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: getPasswordServerCfg(func(b []byte) bool { return string(b) == "forwardpwd" }),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+
+	cfg := &sshdb.TunnelConfig{
+		HostPort:        remoteAddr,
+		UserID:          "me",
+		Pwd:             "forwardpwd",
+		ServerPublicKey: string(ssh.MarshalAuthorizedKey(serverSigner.PublicKey())),
+		Forwards: map[string]sshdb.ForwardConfig{
+			"db": {LocalAddr: "127.0.0.1:0", RemoteAddr: remoteDbAddr},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	forwarders, err := cfg.OpenForwards(ctx)
+	if err != nil {
+		t.Errorf("open forwards failed %v", err)
+		return
+	}
+	fwd := forwarders["db"]
+	if fwd == nil {
+		t.Errorf("expected forwarder db; got %v", forwarders)
+		return
+	}
+	tunnel := sshdb.ForwarderTunnel(fwd)
+
+	conns := make([]net.Conn, 2)
+	for i := range conns {
+		if conns[i], err = net.Dial("tcp", fwd.Addr().String()); err != nil {
+			t.Errorf("dial forwarder %d failed %v", i, err)
+			return
+		}
+		defer conns[i].Close()
+		if err := echoTest(conns[i]); err != nil {
+			t.Errorf("conn %d %v", i, err)
+			return
+		}
+	}
+	if err := connectionCountTest(tunnel, 2); err != nil {
+		t.Errorf("%v", err)
+	}
+	conns[0].Close()
+	if err := waitForConnCount(tunnel, 1); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	// cancelling ctx closes the listener and remaining connections
+	cancel()
+	if err := waitForConnCount(tunnel, 0); err != nil {
+		t.Errorf("%v", err)
+	}
+	if _, err := conns[1].Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF on closed forward; got %v", err)
+	}
+	if c, err := net.Dial("tcp", fwd.Addr().String()); err == nil {
+		c.Close()
+		t.Errorf("expected dial to closed forwarder to fail")
+	}
+}
+
+func TestForwarder_Shutdown(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9243", "localhost:9244"
+	signer, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		key:    signer.PublicKey(),
+		userID: "me",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: getPublicKeyServerCfg("me", signer.PublicKey()),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+	tunnel, err := sshdb.New(ds.clientConfig(), ds.addr)
+	if err != nil {
+		t.Errorf("new tunnel failed %v", err)
+		return
+	}
+	defer tunnel.Close()
+	if _, err := tunnel.Forward(context.Background(), "127.0.0.1:bad", remoteDbAddr); err == nil {
+		t.Errorf("expected listen error")
+	}
+	fwd, err := tunnel.Forward(context.Background(), "127.0.0.1:0", remoteDbAddr)
+	if err != nil {
+		t.Errorf("forward failed %v", err)
+		return
+	}
+	conn, err := net.Dial("tcp", fwd.Addr().String())
+	if err != nil {
+		t.Errorf("dial forwarder failed %v", err)
+		return
+	}
+	if err := echoTest(conn); err != nil {
+		t.Errorf("%v", err)
+	}
+	// shutdown waits for the active connection to close
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := fwd.Shutdown(ctx); err != nil {
+		t.Errorf("expected graceful shutdown; got %v", err)
+	}
+	if err := waitForConnCount(tunnel, 0); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// echoTest writes a buffer to the mock db server and checks the response
+func echoTest(conn net.Conn) error {
+	buff := bytes.Repeat([]byte("0123456789ABCDEF"), 8)
+	if _, err := conn.Write(buff); err != nil {
+		return err
+	}
+	result := make([]byte, len(buff))
+	if _, err := io.ReadFull(conn, result); err != nil {
+		return err
+	}
+	if !bytes.Equal(buff, result) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// waitForConnCount allows piped connections time to close
+func waitForConnCount(tun *sshdb.Tunnel, expectedCnt int) error {
+	var err error
+	for i := 0; i < 20; i++ {
+		if err = connectionCountTest(tun, expectedCnt); err == nil {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return err
+}
+
+func TestTunnel_ListenRemote(t *testing.T) {
+	remoteAddr, remoteListenAddr := "localhost:9245", "127.0.0.1:9246"
+	signer, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		key:    signer.PublicKey(),
+		userID: "me",
+		addr:   remoteAddr,
+		srvcfg: getPublicKeyServerCfg("me", signer.PublicKey()),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+	tunnel, err := sshdb.New(ds.clientConfig(), ds.addr)
+	if err != nil {
+		t.Errorf("new tunnel failed %v", err)
+		return
+	}
+	defer tunnel.Close()
+
+	l, err := tunnel.ListenRemote(context.Background(), remoteListenAddr)
+	if err != nil {
+		t.Errorf("listen remote failed %v", err)
+		return
+	}
+	defer l.Close()
+	if l.Addr().String() != remoteListenAddr {
+		t.Errorf("expected listener addr %s; got %s", remoteListenAddr, l.Addr())
+	}
+	// serve accepted connections locally with the mock db echo handler
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go mockDBPingHandler(conn)
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := remoteEchoTest(remoteListenAddr); err != nil {
+			t.Errorf("pass %d echo failed %v", i, err)
+			return
+		}
+		if err := waitForConnCount(tunnel, 0); err != nil {
+			t.Errorf("%v", err)
+		}
+		// reset tunnel and verify listener is re-established
+		tunnel.Close()
+	}
+	l.Close()
+	if _, err := l.Accept(); err != net.ErrClosed {
+		t.Errorf("expected net.ErrClosed; got %v", err)
+	}
+}
+
+func TestTunnel_ListenRemoteMaxChannels(t *testing.T) {
+	remoteAddr, remoteDbAddr, remoteListenAddr := "localhost:9268", "localhost:9269", "127.0.0.1:9270"
+	signer, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		key:    signer.PublicKey(),
+		userID: "me",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: getPublicKeyServerCfg("me", signer.PublicKey()),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+	tunnel, err := sshdb.New(ds.clientConfig(), ds.addr)
+	if err != nil {
+		t.Errorf("new tunnel failed %v", err)
+		return
+	}
+	defer tunnel.Close()
+	tunnel.SetMaxChannels(2)
+
+	ctx := context.Background()
+	l, err := tunnel.ListenRemote(ctx, remoteListenAddr)
+	if err != nil {
+		t.Errorf("listen remote failed %v", err)
+		return
+	}
+	defer l.Close()
+	acceptChan := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			acceptChan <- conn
+		}
+	}()
+	remoteConn, err := net.Dial("tcp", remoteListenAddr)
+	if err != nil {
+		t.Errorf("remote dial failed %v", err)
+		return
+	}
+	defer remoteConn.Close()
+	select {
+	case conn := <-acceptChan:
+		defer conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Errorf("remote connection not accepted")
+		return
+	}
+	if err := waitForConnCount(tunnel, 1); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	// accepted connection counts toward limit so only one dial succeeds
+	conn0, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+	if err != nil {
+		t.Errorf("conn0 dial failed %v", err)
+		return
+	}
+	defer conn0.Close()
+	ctxTimeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if conn, err := tunnel.DialContext(ctxTimeout, "tcp", remoteDbAddr); err != context.DeadlineExceeded {
+		if err == nil {
+			conn.Close()
+		}
+		t.Errorf("expected context.DeadlineExceeded; got %v", err)
+	}
+}
+
+// remoteEchoTest dials the server's forwarded address, retrying
+// while the remote listener is re-established.
+func remoteEchoTest(addr string) error {
+	var err error
+	for i := 0; i < 50; i++ {
+		var conn net.Conn
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			err = echoTest(conn)
+			conn.Close()
+			if err == nil {
+				return nil
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return err
+}
+
+func TestTunnelConfig_CloseForwards(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9265", "localhost:9266"
+	_, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		userID: "me",
+		pwd:    "forwardpwd",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: getPasswordServerCfg(func(b []byte) bool { return string(b) == "forwardpwd" }),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+
+	cfg := &sshdb.TunnelConfig{
+		HostPort:        remoteAddr,
+		UserID:          "me",
+		Pwd:             "forwardpwd",
+		ServerPublicKey: string(ssh.MarshalAuthorizedKey(serverSigner.PublicKey())),
+		Forwards: map[string]sshdb.ForwardConfig{
+			"db": {LocalAddr: "127.0.0.1:0", RemoteAddr: remoteDbAddr},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	forwarders, err := cfg.OpenForwards(ctx)
+	if err != nil {
+		t.Errorf("open forwards failed %v", err)
+		return
+	}
+	fwd := forwarders["db"]
+	conn, err := net.Dial("tcp", fwd.Addr().String())
+	if err != nil {
+		t.Errorf("dial forwarder failed %v", err)
+		return
+	}
+	defer conn.Close()
+	if err := echoTest(conn); err != nil {
+		t.Errorf("echo %v", err)
+		return
+	}
+	tunnel := sshdb.ForwarderTunnel(fwd)
+	l, err := tunnel.ListenRemote(ctx, "127.0.0.1:9267")
+	if err != nil {
+		t.Errorf("ListenRemote %v", err)
+		return
+	}
+
+	if err := cfg.Close(); err != nil {
+		t.Errorf("Close %v", err)
+	}
+	if c, err := net.Dial("tcp", fwd.Addr().String()); err == nil {
+		defer c.Close()
+		if err := echoTest(c); err == nil {
+			t.Errorf("expected forward to fail after Close")
+		}
+	}
+	if _, err := l.Accept(); err == nil {
+		t.Errorf("expected remote listener to be closed after Close")
+	}
+	if c, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr); err == nil {
+		c.Close()
+		t.Errorf("expected closed tunnel not to reconnect")
+	}
+	if cnt := tunnel.ConnCount(); cnt != 0 {
+		t.Errorf("expected 0 connections after Close; got %d", cnt)
+	}
+}
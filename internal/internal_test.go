@@ -30,3 +30,29 @@ func TestLoadTunnelConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      string
+		tunnels int
+		wantErr bool
+	}{
+		{name: "t01", fn: "../testfiles/multi/config.yaml", tunnels: 2},
+		{name: "t02", fn: "../testfiles/multi/config.json", tunnels: 1},
+		{name: "t03", fn: "../testfiles/config/test19.badformat.yaml", wantErr: true},
+		{name: "t04", fn: "../testfiles/config/test19", wantErr: true},
+	}
+	for idx, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := internal.LoadConfig(tt.fn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%d LoadConfig() error = %v, wantErr %v", idx, err, tt.wantErr)
+				return
+			}
+			if err == nil && len(cfg.Tunnels) != tt.tunnels {
+				t.Errorf("%d LoadConfig() expected %d tunnels; got %d", idx, tt.tunnels, len(cfg.Tunnels))
+			}
+		})
+	}
+}
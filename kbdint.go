@@ -0,0 +1,233 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ChallengeResponder answers the questions of a keyboard-interactive
+// challenge.  A server may send several challenges during authentication,
+// e.g. a password prompt followed by a one-time code prompt.  The returned
+// answers must correspond to questions.
+type ChallengeResponder interface {
+	Respond(user, instruction string, questions []string, echos []bool) ([]string, error)
+}
+
+// ChallengeResponderFunc allows a func to fulfill the ChallengeResponder interface.
+type ChallengeResponderFunc func(user, instruction string, questions []string, echos []bool) ([]string, error)
+
+// Respond calls the underlying func.
+func (f ChallengeResponderFunc) Respond(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	return f(user, instruction, questions, echos)
+}
+
+// KeyboardInteractive returns an ssh.AuthMethod that answers keyboard-interactive
+// challenges with responder.  When a server requires several methods in sequence,
+// such as publickey then keyboard-interactive, include each method in the
+// ssh.ClientConfig; the ssh client continues with the remaining methods after
+// each partial success.
+func KeyboardInteractive(responder ChallengeResponder) ssh.AuthMethod {
+	return ssh.KeyboardInteractive(responder.Respond)
+}
+
+// StaticResponder answers questions using a map of prompts to answers.  A key
+// matches a question if the question contains the key, ignoring case, e.g. the
+// key "password" matches the question "Password: ".  The longest matching key
+// is used.
+type StaticResponder map[string]string
+
+// Respond answers each question or returns an error if a question
+// has no matching key.
+func (sr StaticResponder) Respond(_, _ string, questions []string, _ []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	for i, q := range questions {
+		lq := strings.ToLower(q)
+		matched := ""
+		for k := range sr {
+			if strings.Contains(lq, strings.ToLower(k)) && len(k) > len(matched) {
+				matched = k
+			}
+		}
+		if matched == "" {
+			return nil, fmt.Errorf("no answer for prompt %q", q)
+		}
+		answers[i] = sr[matched]
+	}
+	return answers, nil
+}
+
+// DefaultTOTPPrompts are matched against questions when TOTPResponder.Prompts is empty.
+var DefaultTOTPPrompts = []string{"verification code", "one-time", "otp", "token", "passcode", "code"}
+
+// TOTPResponder answers one-time password prompts with RFC 6238 TOTP codes
+// (HMAC-SHA1) generated from Secret.  Other questions are passed to Next.
+type TOTPResponder struct {
+	// Secret is the base32 encoded shared secret, as shown by most
+	// authenticator enrollment screens.  Spaces and padding are ignored.
+	Secret string
+	// Digits is the code length, at most 9.  Defaults to 6.
+	Digits int
+	// Period is the time step, a whole number of seconds.  Defaults to 30s.
+	Period time.Duration
+	// Prompts identify one-time password questions.  A question matches if it
+	// contains a prompt, ignoring case.  DefaultTOTPPrompts is used when empty.
+	Prompts []string
+	// Next answers questions that are not one-time password prompts.  If nil,
+	// such questions cause an error.
+	Next ChallengeResponder
+}
+
+// Respond answers one-time password questions with the current code and
+// passes other questions to Next.
+func (tr *TOTPResponder) Respond(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	var otherIdx []int
+	var otherQuestions []string
+	var otherEchos []bool
+	for i, q := range questions {
+		if !tr.isTOTPPrompt(q) {
+			otherIdx = append(otherIdx, i)
+			otherQuestions = append(otherQuestions, q)
+			if i < len(echos) {
+				otherEchos = append(otherEchos, echos[i])
+			}
+			continue
+		}
+		code, err := tr.Code(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		answers[i] = code
+	}
+	if len(otherIdx) == 0 {
+		return answers, nil
+	}
+	if tr.Next == nil {
+		return nil, fmt.Errorf("no answer for prompt %q", otherQuestions[0])
+	}
+	otherAnswers, err := tr.Next.Respond(user, instruction, otherQuestions, otherEchos)
+	if err != nil {
+		return nil, err
+	}
+	if len(otherAnswers) != len(otherIdx) {
+		return nil, fmt.Errorf("expected %d answers; got %d", len(otherIdx), len(otherAnswers))
+	}
+	for i, idx := range otherIdx {
+		answers[idx] = otherAnswers[i]
+	}
+	return answers, nil
+}
+
+func (tr *TOTPResponder) isTOTPPrompt(q string) bool {
+	prompts := tr.Prompts
+	if len(prompts) == 0 {
+		prompts = DefaultTOTPPrompts
+	}
+	q = strings.ToLower(q)
+	for _, p := range prompts {
+		if strings.Contains(q, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Code returns the TOTP code for time t.
+func (tr *TOTPResponder) Code(t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(tr.Secret)
+	if err != nil {
+		return "", err
+	}
+	digits, period := tr.Digits, tr.Period
+	if digits <= 0 {
+		digits = 6
+	}
+	if digits > 9 {
+		return "", fmt.Errorf("totp digits must not exceed 9; got %d", digits)
+	}
+	if period == 0 {
+		period = 30 * time.Second
+	}
+	if period < time.Second || period%time.Second != 0 {
+		return "", fmt.Errorf("totp period must be a whole number of seconds; got %v", period)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(t.Unix()/int64(period/time.Second)))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod), nil
+}
+
+// decodeTOTPSecret decodes a base32 secret ignoring case, spaces and padding
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid totp secret - %w", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty totp secret")
+	}
+	return key, nil
+}
+
+// KeyboardInteractiveConfig describes the answers to keyboard-interactive
+// challenges in a TunnelConfig.
+type KeyboardInteractiveConfig struct {
+	// map of prompts to answers.  See StaticResponder.  If no key matches "password",
+	// the Pwd value of the TunnelConfig answers password prompts.
+	Answers map[string]string `yaml:"answers,omitempty" json:"answers,omitempty"`
+	// base32 encoded secret used to answer one-time password prompts.  See TOTPResponder.
+	TOTPSecret string `yaml:"totp_secret,omitempty" json:"totp_secret,omitempty"`
+	// number of digits in a code.  Defaults to 6.
+	TOTPDigits int `yaml:"totp_digits,omitempty" json:"totp_digits,omitempty"`
+	// time step of codes, a whole number of seconds.  Defaults to 30s.
+	TOTPPeriod Duration `yaml:"totp_period,omitempty" json:"totp_period,omitempty"`
+	// prompts identifying one-time password questions.  Defaults to DefaultTOTPPrompts.
+	TOTPPrompts []string `yaml:"totp_prompts,omitempty" json:"totp_prompts,omitempty"`
+}
+
+// responder creates a ChallengeResponder from the config.  pwd answers
+// password prompts when Answers has no password entry.
+func (kc *KeyboardInteractiveConfig) responder(pwd string) (ChallengeResponder, error) {
+	answers := make(StaticResponder)
+	for k, v := range kc.Answers {
+		answers[k] = v
+	}
+	if _, err := answers.Respond("", "", []string{"password"}, nil); err != nil && pwd > "" {
+		answers["password"] = pwd
+	}
+	if kc.TOTPSecret == "" {
+		return answers, nil
+	}
+	tr := &TOTPResponder{
+		Secret:  kc.TOTPSecret,
+		Digits:  kc.TOTPDigits,
+		Period:  time.Duration(kc.TOTPPeriod),
+		Prompts: kc.TOTPPrompts,
+		Next:    answers,
+	}
+	if _, err := tr.Code(time.Now()); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
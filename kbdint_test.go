@@ -0,0 +1,204 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jfcote87/sshdb"
+	"golang.org/x/crypto/ssh"
+)
+
+// rfcSecret is the base32 encoding of the RFC 6238 test secret "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPResponder_Code(t *testing.T) {
+	tests := []struct {
+		unix   int64
+		digits int
+		want   string
+	}{
+		{unix: 59, digits: 8, want: "94287082"},
+		{unix: 1111111109, digits: 8, want: "07081804"},
+		{unix: 1111111111, digits: 8, want: "14050471"},
+		{unix: 1234567890, digits: 8, want: "89005924"},
+		{unix: 2000000000, digits: 8, want: "69279037"},
+		{unix: 59, want: "287082"},
+	}
+	for _, tt := range tests {
+		tr := &sshdb.TOTPResponder{Secret: rfcSecret, Digits: tt.digits}
+		code, err := tr.Code(time.Unix(tt.unix, 0))
+		if err != nil || code != tt.want {
+			t.Errorf("%d expected %s; got %s %v", tt.unix, tt.want, code, err)
+		}
+	}
+	lower := &sshdb.TOTPResponder{Secret: "gezd gnbv gy3t qojq gezd gnbv gy3t qojq"}
+	if code, err := lower.Code(time.Unix(59, 0)); err != nil || code != "287082" {
+		t.Errorf("expected spaced lower case secret to be accepted; got %s %v", code, err)
+	}
+	for _, bad := range []*sshdb.TOTPResponder{{Secret: "not base32!"}, {}, {Secret: rfcSecret, Digits: 10},
+		{Secret: rfcSecret, Period: 500 * time.Millisecond}, {Secret: rfcSecret, Period: 1500 * time.Millisecond},
+		{Secret: rfcSecret, Period: -time.Second}} {
+		if _, err := bad.Code(time.Now()); err == nil {
+			t.Errorf("expected error for %#v", bad)
+		}
+	}
+}
+
+func TestChallengeResponders(t *testing.T) {
+	static := sshdb.StaticResponder{"password": "pwd", "pin": "1234", "backup pin": "5678"}
+	answers, err := static.Respond("me", "", []string{"Password: ", "Backup PIN:", "PIN:"}, []bool{false, false, false})
+	if err != nil || !reflect.DeepEqual(answers, []string{"pwd", "5678", "1234"}) {
+		t.Errorf("expected static answers; got %v %v", answers, err)
+	}
+	if _, err := static.Respond("me", "", []string{"Favorite color?"}, []bool{true}); err == nil {
+		t.Errorf("expected unknown prompt error")
+	}
+
+	tr := &sshdb.TOTPResponder{Secret: rfcSecret, Next: static}
+	code, _ := tr.Code(time.Now())
+	answers, err = tr.Respond("me", "", []string{"Password: ", "Verification code: "}, []bool{false, true})
+	if err != nil || len(answers) != 2 || answers[0] != "pwd" {
+		t.Errorf("expected password and code; got %v %v", answers, err)
+	} else if answers[1] != code {
+		// code may have changed at a period boundary
+		if next, _ := tr.Code(time.Now()); answers[1] != next {
+			t.Errorf("expected code %s; got %s", next, answers[1])
+		}
+	}
+	tr.Next = nil
+	if _, err := tr.Respond("me", "", []string{"Password: "}, []bool{false}); err == nil {
+		t.Errorf("expected error for password prompt with nil Next")
+	}
+}
+
+func TestTunnelConfig_KeyboardInteractive(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9255", "localhost:9256"
+	_, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	totp := &sshdb.TOTPResponder{Secret: rfcSecret}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		userID: "me",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: &ssh.ServerConfig{
+			// reject keys so that the client continues with keyboard-interactive
+			PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+				return nil, errors.New("keys not accepted")
+			},
+			KeyboardInteractiveCallback: func(meta ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+				answers, err := client("me", "enter password", []string{"Password: "}, []bool{false})
+				if err != nil || len(answers) != 1 || answers[0] != "kbdpwd" {
+					return nil, errors.New("invalid password")
+				}
+				answers, err = client("me", "second factor", []string{"Verification code: "}, []bool{true})
+				if err != nil || len(answers) != 1 {
+					return nil, errors.New("invalid code")
+				}
+				now := time.Now()
+				for _, tm := range []time.Time{now, now.Add(-30 * time.Second)} {
+					if code, _ := totp.Code(tm); code == answers[0] {
+						return &ssh.Permissions{}, nil
+					}
+				}
+				return nil, errors.New("invalid code")
+			},
+		},
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+
+	tests := []struct {
+		name      string
+		kbd       *sshdb.KeyboardInteractiveConfig
+		responder sshdb.ChallengeResponder
+		wantErr   bool
+	}{
+		{name: "totp", kbd: &sshdb.KeyboardInteractiveConfig{TOTPSecret: rfcSecret}},
+		{name: "answers", kbd: &sshdb.KeyboardInteractiveConfig{
+			Answers: map[string]string{"password": "kbdpwd", "code": "000000"}}, wantErr: true},
+		{name: "wrong_secret", kbd: &sshdb.KeyboardInteractiveConfig{TOTPSecret: "JBSWY3DPEHPK3PXP"}, wantErr: true},
+		{name: "responder", responder: sshdb.ChallengeResponderFunc(
+			func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				if instruction == "enter password" {
+					return []string{"kbdpwd"}, nil
+				}
+				code, err := totp.Code(time.Now())
+				return []string{code}, err
+			})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &sshdb.TunnelConfig{
+				HostPort:            remoteAddr,
+				UserID:              "me",
+				Pwd:                 "kbdpwd",
+				ClientKey:           clientPrivateKey,
+				ClientKeyPwd:        "sshdb_example",
+				KeyboardInteractive: tt.kbd,
+				ChallengeResponder:  tt.responder,
+				ServerPublicKey:     string(ssh.MarshalAuthorizedKey(serverSigner.PublicKey())),
+				Forwards: map[string]sshdb.ForwardConfig{
+					"db": {LocalAddr: "127.0.0.1:0", RemoteAddr: remoteDbAddr},
+				},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			forwarders, err := cfg.OpenForwards(ctx)
+			if err != nil {
+				t.Errorf("open forwards failed %v", err)
+				return
+			}
+			defer forwarders["db"].Close()
+			tunnel := sshdb.ForwarderTunnel(forwarders["db"])
+			defer tunnel.Close()
+			conn, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+			if tt.wantErr {
+				if err == nil {
+					conn.Close()
+					t.Errorf("expected authentication error")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("dial failed %v", err)
+				return
+			}
+			defer conn.Close()
+			if err := echoTest(conn); err != nil {
+				t.Errorf("echo %v", err)
+			}
+		})
+	}
+}
+
+func TestTunnelConfig_Validate_TOTPPeriod(t *testing.T) {
+	for _, period := range []time.Duration{500 * time.Millisecond, 1500 * time.Millisecond} {
+		tc := &sshdb.TunnelConfig{
+			HostPort: "localhost:9263",
+			UserID:   "me",
+			KeyboardInteractive: &sshdb.KeyboardInteractiveConfig{
+				TOTPSecret: rfcSecret,
+				TOTPPeriod: sshdb.Duration(period),
+			},
+		}
+		if err := tc.Validate(); !errors.Is(err, sshdb.ErrKeyboardInteractive) {
+			t.Errorf("period %v expected ErrKeyboardInteractive; got %v", period, err)
+		}
+	}
+}
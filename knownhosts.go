@@ -0,0 +1,215 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHostsCallback returns an ssh.HostKeyCallback that verifies host keys using
+// the OpenSSH known_hosts file fn, including hashed host names, non-default ports
+// ("[host]:port") and @cert-authority and @revoked markers.  fn may list several
+// files separated by os.PathListSeparator, in which case keys are checked against
+// all of the files that exist.  A leading "~/" in a file name is replaced by the
+// user's home directory.  The files are reread on each handshake.
+//
+// If trustOnFirstUse is true, the key of a host without an entry is appended to the
+// first file and accepted.  The file and its directory are created when the first
+// key is recorded.  A host whose key differs from its recorded key is always rejected.
+func KnownHostsCallback(fn string, trustOnFirstUse bool) (ssh.HostKeyCallback, error) {
+	files, err := knownHostsFiles(fn)
+	if err != nil {
+		return nil, err
+	}
+	// verify that a file exists and the files parse
+	if _, err := newKnownHosts(files); err != nil && !(trustOnFirstUse && os.IsNotExist(err)) {
+		return nil, err
+	}
+	kh := &knownHosts{files: files, tofu: trustOnFirstUse}
+	return kh.check, nil
+}
+
+// knownHostsFiles splits fn into its file names and replaces a leading "~/"
+// of each
+func knownHostsFiles(fn string) ([]string, error) {
+	var files []string
+	for _, f := range filepath.SplitList(fn) {
+		f, err := expandHome(f)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no known hosts file specified")
+	}
+	return files, nil
+}
+
+// newKnownHosts returns a knownhosts callback for the files that exist.  If
+// no file exists, the error for the first file is returned.
+func newKnownHosts(files []string) (ssh.HostKeyCallback, error) {
+	var found []string
+	var notExistErr error
+	for _, f := range files {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			if notExistErr == nil {
+				notExistErr = err
+			}
+			continue
+		}
+		found = append(found, f)
+	}
+	if len(found) == 0 {
+		return nil, notExistErr
+	}
+	return knownhosts.New(found...)
+}
+
+// knownHostsMu serializes known_hosts reads and writes
+var knownHostsMu sync.Mutex
+
+type knownHosts struct {
+	files []string // new keys are recorded in files[0]
+	tofu  bool
+}
+
+func (kh *knownHosts) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+	cb, err := newKnownHosts(kh.files)
+	switch {
+	case err == nil:
+		err = cb(hostname, remote, key)
+	case kh.tofu && os.IsNotExist(err):
+		// no file so the host is unknown
+		err = &knownhosts.KeyError{}
+	default:
+		return err
+	}
+	var keyErr *knownhosts.KeyError
+	if !kh.tofu || !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+		return err
+	}
+	// unknown host so record key
+	fn := kh.files[0]
+	b, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		line = "\n" + line
+	}
+	if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// anyHostKey accepts a host key if any of callbacks accepts it.  If all
+// fail, the error of the last callback is returned.
+func anyHostKey(callbacks []ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		var err error
+		for _, cb := range callbacks {
+			if err = cb(hostname, remote, key); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+}
+
+// expandHome replaces a leading "~/" with the user's home directory
+func expandHome(fn string) (string, error) {
+	if !strings.HasPrefix(fn, "~/") {
+		return fn, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, fn[2:]), nil
+}
+
+// defaultHostKeyAlgos is the ssh package's default host key algorithm list
+var defaultHostKeyAlgos = []string{
+	ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	ssh.KeyAlgoED25519,
+}
+
+// knownHostKeyAlgorithms returns host key algorithms ordered so that the types of
+// keys recorded in the known_hosts files of fn for hostport are preferred, as
+// OpenSSH does.  Otherwise a server may present a key of a different type than
+// the one recorded.  Returns nil if no keys are recorded.
+func knownHostKeyAlgorithms(fn, hostport string) []string {
+	files, err := knownHostsFiles(fn)
+	if err != nil {
+		return nil
+	}
+	knownHostsMu.Lock()
+	cb, err := newKnownHosts(files)
+	knownHostsMu.Unlock()
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if err := cb(hostport, &net.TCPAddr{IP: net.IPv4zero}, probeKey{}); !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+	var algos []string
+	known := make(map[string]bool)
+	for _, k := range keyErr.Want {
+		typeAlgos := []string{k.Key.Type()}
+		if k.Key.Type() == ssh.KeyAlgoRSA {
+			typeAlgos = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, a := range typeAlgos {
+			if !known[a] {
+				known[a] = true
+				algos = append(algos, a)
+			}
+		}
+	}
+	for _, a := range defaultHostKeyAlgos {
+		if !known[a] {
+			algos = append(algos, a)
+		}
+	}
+	return algos
+}
+
+// probeKey is a public key that matches no known_hosts entry.  It is used to
+// list the keys recorded for a host.
+type probeKey struct{}
+
+func (probeKey) Type() string                        { return "sshdb-probe" }
+func (probeKey) Marshal() []byte                     { return []byte("sshdb-probe") }
+func (probeKey) Verify([]byte, *ssh.Signature) error { return errors.New("probe key") }
@@ -0,0 +1,220 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jfcote87/sshdb"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestTunnelConfig_KnownHosts(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9253", "localhost:9254"
+	_, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		userID: "me",
+		pwd:    "knownhostspwd",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: getPasswordServerCfg(func(b []byte) bool { return string(b) == "knownhostspwd" }),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+
+	dir := t.TempDir()
+	host := knownhosts.Normalize(remoteAddr)
+	serverLine := knownhosts.Line([]string{host}, serverSigner.PublicKey())
+	hashedLine := knownhosts.Line([]string{knownhosts.HashHostname(host)}, serverSigner.PublicKey())
+	otherLine := knownhosts.Line([]string{host}, newSigner().PublicKey())
+	defaultPortLine := knownhosts.Line([]string{"localhost"}, serverSigner.PublicKey())
+	tofuFile := filepath.Join(dir, "tofu", "known_hosts")
+
+	tests := []struct {
+		name    string
+		content string // written to known_hosts when not empty
+		fn      string
+		tofu    bool
+		wantErr bool
+	}{
+		{name: "known", content: serverLine},
+		{name: "hashed", content: "# comment\n" + hashedLine},
+		{name: "default_port", content: defaultPortLine, wantErr: true},
+		{name: "changed", content: otherLine, wantErr: true},
+		{name: "changed_tofu", content: otherLine, tofu: true, wantErr: true},
+		{name: "unknown", content: "# empty\n", wantErr: true},
+		{name: "tofu", fn: tofuFile, tofu: true},
+		{name: "after_tofu", fn: tofuFile},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := tt.fn
+			if tt.content > "" {
+				fn = filepath.Join(dir, tt.name)
+				if err := ioutil.WriteFile(fn, []byte(tt.content), 0600); err != nil {
+					t.Errorf("write known_hosts %v", err)
+					return
+				}
+			}
+			cfg := &sshdb.TunnelConfig{
+				HostPort:              remoteAddr,
+				UserID:                "me",
+				Pwd:                   "knownhostspwd",
+				KnownHostsFile:        fn,
+				TrustOnFirstUse:       tt.tofu,
+				StrictHostKeyChecking: true,
+				Forwards: map[string]sshdb.ForwardConfig{
+					"db": {LocalAddr: "127.0.0.1:0", RemoteAddr: remoteDbAddr},
+				},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			forwarders, err := cfg.OpenForwards(ctx)
+			if err != nil {
+				t.Errorf("%d open forwards failed %v", i, err)
+				return
+			}
+			defer forwarders["db"].Close()
+			tunnel := sshdb.ForwarderTunnel(forwarders["db"])
+			defer tunnel.Close()
+			conn, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+			if tt.wantErr {
+				if err == nil {
+					conn.Close()
+					t.Errorf("expected host key error")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("dial failed %v", err)
+				return
+			}
+			defer conn.Close()
+			if err := echoTest(conn); err != nil {
+				t.Errorf("echo %v", err)
+			}
+		})
+	}
+	b, err := ioutil.ReadFile(tofuFile)
+	if err != nil || strings.TrimSpace(string(b)) != serverLine {
+		t.Errorf("expected tofu file to contain %q; got %q %v", serverLine, b, err)
+	}
+}
+
+func TestKnownHostsCallback(t *testing.T) {
+	_, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	hostCA := newSigner()
+	cert, err := signCert(hostCA, serverSigner.PublicKey(), ssh.HostCert, []string{"db.example.com"}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Errorf("sign cert %v", err)
+		return
+	}
+	fn := filepath.Join(t.TempDir(), "known_hosts")
+	content := "@cert-authority *.example.com " + string(ssh.MarshalAuthorizedKey(hostCA.PublicKey())) +
+		"@revoked * " + string(ssh.MarshalAuthorizedKey(serverSigner.PublicKey()))
+	if err := ioutil.WriteFile(fn, []byte(content), 0600); err != nil {
+		t.Errorf("write known_hosts %v", err)
+		return
+	}
+	cb, err := sshdb.KnownHostsCallback(fn, false)
+	if err != nil {
+		t.Errorf("KnownHostsCallback %v", err)
+		return
+	}
+	remote := &net.TCPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 22}
+	if err := cb("db.example.com:22", remote, cert); err != nil {
+		t.Errorf("expected cert to be accepted; got %v", err)
+	}
+	if err := cb("db.other.com:22", remote, cert); err == nil {
+		t.Errorf("expected cert for unmatched host to be rejected")
+	}
+	var revokedErr *knownhosts.RevokedError
+	if err := cb("db.example.com:22", remote, serverSigner.PublicKey()); !errors.As(err, &revokedErr) {
+		t.Errorf("expected RevokedError; got %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	if _, err := sshdb.KnownHostsCallback(missing, false); err == nil {
+		t.Errorf("expected missing file error")
+	}
+	// missing files in a list are skipped
+	cb, err = sshdb.KnownHostsCallback(missing+string(os.PathListSeparator)+fn, false)
+	if err != nil {
+		t.Errorf("KnownHostsCallback list %v", err)
+		return
+	}
+	if err := cb("db.example.com:22", remote, cert); err != nil {
+		t.Errorf("expected cert to be accepted from second file; got %v", err)
+	}
+
+	// trust on first use creates the file only when a key is recorded
+	tofuFile := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+	tofu, err := sshdb.KnownHostsCallback(tofuFile, true)
+	if err != nil {
+		t.Errorf("KnownHostsCallback tofu %v", err)
+		return
+	}
+	if _, err := os.Stat(filepath.Dir(tofuFile)); !os.IsNotExist(err) {
+		t.Errorf("expected known_hosts directory not to be created before first use; got %v", err)
+	}
+	if err := tofu("db.example.com:22", remote, serverSigner.PublicKey()); err != nil {
+		t.Errorf("expected tofu to accept key; got %v", err)
+	}
+	if err := tofu("db.example.com:22", remote, newSigner().PublicKey()); err == nil {
+		t.Errorf("expected tofu to reject changed key")
+	}
+	b, err := ioutil.ReadFile(tofuFile)
+	if want := knownhosts.Line([]string{"db.example.com"}, serverSigner.PublicKey()); err != nil || strings.TrimSpace(string(b)) != want {
+		t.Errorf("expected tofu file to contain %q; got %q %v", want, b, err)
+	}
+}
+
+func TestTunnelConfig_TrustOnFirstUsePinned(t *testing.T) {
+	_, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	fn := filepath.Join(t.TempDir(), "known_hosts")
+	for _, tc := range []*sshdb.TunnelConfig{
+		{ServerPublicKey: string(ssh.MarshalAuthorizedKey(serverSigner.PublicKey()))},
+		{ServerCAKeys: []string{string(ssh.MarshalAuthorizedKey(newSigner().PublicKey()))}},
+	} {
+		tc.HostPort, tc.UserID, tc.Pwd = "localhost:9263", "me", "pwd"
+		tc.KnownHostsFile, tc.TrustOnFirstUse = fn, true
+		tc.Forwards = map[string]sshdb.ForwardConfig{"db": {LocalAddr: "127.0.0.1:0", RemoteAddr: "localhost:9264"}}
+		if err := tc.Validate(); !errors.Is(err, sshdb.ErrTrustOnFirstUse) {
+			t.Errorf("expected ErrTrustOnFirstUse; got %v", err)
+		}
+		if _, err := tc.OpenForwards(context.Background()); !errors.Is(err, sshdb.ErrTrustOnFirstUse) {
+			t.Errorf("OpenForwards expected ErrTrustOnFirstUse; got %v", err)
+		}
+	}
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("expected known_hosts not to be created; got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jfcote87/sshdb"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the environment variable prefix used by
+// LoadTunnelConfigFromEnv when prefix is empty.
+const DefaultEnvPrefix = "SSHDB"
+
+// LoadTunnelConfigFromEnv builds a sshdb.TunnelConfig from environment
+// variables beginning with prefix and an underscore.  See DecodeEnv.
+func LoadTunnelConfigFromEnv(prefix string) (*sshdb.TunnelConfig, error) {
+	var tc *sshdb.TunnelConfig
+	if err := DecodeEnv(os.Environ(), prefix, &tc); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// DecodeEnv decodes the environ entries ("KEY=value") beginning with prefix
+// and an underscore into v.  DefaultEnvPrefix is used when prefix is empty.
+// The remainder of each key is the upper case path of yaml field names
+// joined by underscores, e.g.
+//
+//	SSHDB_HOSTPORT=bastion.example.com:22
+//	SSHDB_USER_ID=deploy
+//	SSHDB_PWD=${file:/run/secrets/ssh_pwd}
+//	SSHDB_KEEPALIVE_INTERVAL=30s
+//	SSHDB_DATASOURCES_ORDERS_DRIVER_NAME=mysql
+//	SSHDB_DATASOURCES_ORDERS_DSN=app:${env:ORDERS_PWD}@tcp(orders.internal:3306)/orders
+//	SSHDB_JUMP_HOSTS_0_HOSTPORT=jump.example.com:22
+//	SSHDB_SERVER_CA_KEYS=ssh-ed25519 AAAA...,ssh-ed25519 AAAA...
+//
+// Map keys, such as datasource names, are lower cased.  List elements are
+// selected by index, and lists of strings are comma separated.  Values are
+// not expanded.  An error is returned if no variables match prefix or a key
+// does not match a field.
+func DecodeEnv(environ []string, prefix string, v interface{}) error {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	prefix = strings.ToUpper(prefix) + "_"
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return fmt.Errorf("nil destination")
+	}
+	environ = append([]string(nil), environ...)
+	sort.Strings(environ)
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, kv := range environ {
+		idx := strings.Index(kv, "=")
+		if idx < 0 || !strings.HasPrefix(kv[:idx], prefix) {
+			continue
+		}
+		key, val := kv[len(prefix):idx], kv[idx+1:]
+		path, leaf, ok := envPath(t, strings.Split(key, "_"))
+		if !ok {
+			return fmt.Errorf("environment variable %s does not match a config field", kv[:idx])
+		}
+		setEnvNode(root, path, leafNode(leaf, val))
+	}
+	if len(root.Content) == 0 {
+		return fmt.Errorf("no environment variables found with prefix %s", prefix)
+	}
+	return root.Decode(v)
+}
+
+// maxEnvIndex limits list indexes in variable names
+const maxEnvIndex = 100
+
+// envElem is a mapping key or sequence index in a path
+type envElem struct {
+	key   string
+	index int // sequence index when key is empty
+}
+
+// envPath matches the upper case key parts to the yaml field names of t.
+// The path and the type of the value are returned.
+func envPath(t reflect.Type, parts []string) ([]envElem, reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if len(parts) == 0 {
+		return nil, t, isEnvLeaf(t)
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			tagParts := strings.Split(strings.ToUpper(tag), "_")
+			if len(tagParts) > len(parts) || strings.Join(tagParts, "_") != strings.Join(parts[:len(tagParts)], "_") {
+				continue
+			}
+			if path, leaf, ok := envPath(t.Field(i).Type, parts[len(tagParts):]); ok {
+				return append([]envElem{{key: tag}}, path...), leaf, true
+			}
+		}
+	case reflect.Map:
+		// names may contain underscores, so try the longest name first
+		for n := len(parts); n > 0; n-- {
+			if path, leaf, ok := envPath(t.Elem(), parts[n:]); ok {
+				key := strings.ToLower(strings.Join(parts[:n], "_"))
+				return append([]envElem{{key: key}}, path...), leaf, true
+			}
+		}
+	case reflect.Slice:
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil || idx < 0 || idx >= maxEnvIndex {
+			break
+		}
+		if path, leaf, ok := envPath(t.Elem(), parts[1:]); ok {
+			return append([]envElem{{index: idx}}, path...), leaf, true
+		}
+	}
+	return nil, nil, false
+}
+
+// isEnvLeaf reports whether a single variable may hold a value of type t
+func isEnvLeaf(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Interface:
+		return false
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return true
+}
+
+// leafNode creates the node for val.  Strings are tagged so that values
+// such as "123" or "null" remain strings.
+func leafNode(t reflect.Type, val string) *yaml.Node {
+	if t.Kind() == reflect.Slice {
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, s := range strings.Split(val, ",") {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: strings.TrimSpace(s)})
+		}
+		return node
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: val}
+	if t.Kind() == reflect.String {
+		node.Tag = "!!str"
+	}
+	return node
+}
+
+// setEnvNode sets the value at path creating mappings and sequences as needed
+func setEnvNode(node *yaml.Node, path []envElem, value *yaml.Node) {
+	for i, elem := range path {
+		var next *yaml.Node
+		if i == len(path)-1 {
+			next = value
+		} else if path[i+1].key == "" {
+			next = &yaml.Node{Kind: yaml.SequenceNode}
+		} else {
+			next = &yaml.Node{Kind: yaml.MappingNode}
+		}
+		if elem.key == "" {
+			for len(node.Content) <= elem.index {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.MappingNode})
+			}
+			if i == len(path)-1 || node.Content[elem.index].Kind != next.Kind {
+				node.Content[elem.index] = next
+			}
+			node = node.Content[elem.index]
+			continue
+		}
+		found := false
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == elem.key {
+				if i == len(path)-1 {
+					node.Content[j+1] = next
+				}
+				node, found = node.Content[j+1], true
+				break
+			}
+		}
+		if !found {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: elem.key}, next)
+			node = next
+		}
+	}
+}
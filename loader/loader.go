@@ -0,0 +1,386 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package loader reads sshdb.TunnelConfig and sshdb.Config values from yaml,
+// json or toml, or from environment variables (see LoadTunnelConfigFromEnv).
+// Before decoding, ${VAR} and ${VAR:-default} references in string values are
+// replaced with environment variables, and files listed in a top level include
+// entry are merged beneath the document.
+//
+//	# prod.yaml
+//	include: base.yaml
+//	hostport: ${BASTION:-bastion.example.com:22}
+//	datasources:
+//	  orders:
+//	    dsn: app:${env:ORDERS_PWD}@tcp(orders.internal:3306)/orders
+//
+// Included files are decoded first, in order, and the including document
+// overrides their values.  Mappings are merged key by key while lists and
+// other values are replaced.  Relative include paths are relative to the
+// directory of the including file (the working directory for a Reader).
+//
+// Secret placeholders such as ${env:NAME} are not environment references
+// and are left for sshdb.ExpandSecrets.  Use $${ for a literal ${.
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jfcote87/sshdb"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies the encoding of a config
+type Format string
+
+// Supported formats
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+	TOML Format = "toml"
+)
+
+// IncludeKey is the top level key listing files to merge
+const IncludeKey = "include"
+
+// maxIncludeDepth limits nested includes
+const maxIncludeDepth = 16
+
+// FormatOf returns the Format indicated by the extension of fn.
+func FormatOf(fn string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".json":
+		return JSON, nil
+	case ".toml":
+		return TOML, nil
+	}
+	return "", fmt.Errorf("file must end with either .json, .toml, .yaml, or .yml")
+}
+
+// LoadTunnelConfig reads a sshdb.TunnelConfig from fn.  The format is
+// determined by the file extension.
+func LoadTunnelConfig(fn string) (*sshdb.TunnelConfig, error) {
+	var tc *sshdb.TunnelConfig
+	if err := DecodeFile(fn, &tc); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// LoadConfig reads a sshdb.Config from fn.  The format is determined by
+// the file extension.
+func LoadConfig(fn string) (*sshdb.Config, error) {
+	var cfg *sshdb.Config
+	if err := DecodeFile(fn, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ReadTunnelConfig reads a sshdb.TunnelConfig from r using format.
+func ReadTunnelConfig(r io.Reader, format Format) (*sshdb.TunnelConfig, error) {
+	var tc *sshdb.TunnelConfig
+	if err := Decode(r, format, &tc); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// ReadConfig reads a sshdb.Config from r using format.
+func ReadConfig(r io.Reader, format Format) (*sshdb.Config, error) {
+	var cfg *sshdb.Config
+	if err := Decode(r, format, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// DecodeFile expands, merges and decodes fn into v.  The format is
+// determined by the file extension.
+func DecodeFile(fn string, v interface{}) error {
+	node, err := (&loader{}).loadFile(fn, 0)
+	if err != nil {
+		return err
+	}
+	return decodeNode(node, v)
+}
+
+// Decode expands, merges and decodes the contents of r into v.
+func Decode(r io.Reader, format Format, v interface{}) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	node, err := (&loader{}).load(b, format, "", 0)
+	if err != nil {
+		return err
+	}
+	return decodeNode(node, v)
+}
+
+func decodeNode(node *yaml.Node, v interface{}) error {
+	if node == nil {
+		return io.EOF
+	}
+	return node.Decode(v)
+}
+
+// loader tracks the files being loaded to detect include cycles
+type loader struct {
+	files []string
+}
+
+func (l *loader) loadFile(fn string, depth int) (*yaml.Node, error) {
+	format, err := FormatOf(fn)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(fn)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range l.files {
+		if f == abs {
+			return nil, fmt.Errorf("include cycle at %s", fn)
+		}
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	l.files = append(l.files, abs)
+	defer func() { l.files = l.files[:len(l.files)-1] }()
+	node, err := l.load(b, format, filepath.Dir(fn), depth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return node, nil
+}
+
+// load parses b, expands environment references and merges includes.
+// The returned node is the document's root or nil for an empty document.
+func (l *loader) load(b []byte, format Format, dir string, depth int) (*yaml.Node, error) {
+	switch format {
+	case YAML:
+	case JSON:
+		// validate as json as the yaml parser accepts a superset
+		var js interface{}
+		if err := json.NewDecoder(bytes.NewReader(b)).Decode(&js); err != nil {
+			return nil, err
+		}
+	case TOML:
+		return l.loadTOML(b, dir, depth)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return l.process(doc.Content[0], dir, depth)
+}
+
+// loadTOML converts a toml document to a yaml node so that field
+// names and decoding match the yaml tags
+func (l *loader) loadTOML(b []byte, dir string, depth int) (*yaml.Node, error) {
+	var m map[string]interface{}
+	if _, err := toml.Decode(string(b), &m); err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+	var root yaml.Node
+	if err := root.Encode(m); err != nil {
+		return nil, err
+	}
+	return l.process(&root, dir, depth)
+}
+
+// process expands environment references in root and merges includes
+func (l *loader) process(root *yaml.Node, dir string, depth int) (*yaml.Node, error) {
+	if err := expandNode(root); err != nil {
+		return nil, err
+	}
+	return l.include(root, dir, depth)
+}
+
+// include removes the include entry from root and merges root over
+// the listed files
+func (l *loader) include(root *yaml.Node, dir string, depth int) (*yaml.Node, error) {
+	if root.Kind != yaml.MappingNode {
+		return root, nil
+	}
+	var files []string
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != IncludeKey {
+			continue
+		}
+		if err := root.Content[i+1].Decode(&files); err != nil {
+			var fn string
+			if err := root.Content[i+1].Decode(&fn); err != nil {
+				return nil, fmt.Errorf("include must be a file name or list of file names")
+			}
+			files = []string{fn}
+		}
+		root.Content = append(root.Content[:i:i], root.Content[i+2:]...)
+		break
+	}
+	if len(files) == 0 {
+		return root, nil
+	}
+	if depth >= maxIncludeDepth {
+		return nil, fmt.Errorf("include depth exceeded")
+	}
+	var merged *yaml.Node
+	for _, fn := range files {
+		if !filepath.IsAbs(fn) && dir > "" {
+			fn = filepath.Join(dir, fn)
+		}
+		node, err := l.loadFile(fn, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		merged = merge(merged, node)
+	}
+	return merge(merged, root), nil
+}
+
+// merge returns over merged onto base.  Mapping keys are merged recursively;
+// all other values in over replace those in base.
+func merge(base, over *yaml.Node) *yaml.Node {
+	if base == nil || base.Kind != yaml.MappingNode || over == nil || over.Kind != yaml.MappingNode {
+		if over == nil {
+			return base
+		}
+		return over
+	}
+	result := &yaml.Node{Kind: yaml.MappingNode, Tag: base.Tag, Content: append([]*yaml.Node(nil), base.Content...)}
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, val := over.Content[i], over.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(result.Content); j += 2 {
+			if result.Content[j].Value == key.Value {
+				result.Content[j+1] = merge(result.Content[j+1], val)
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Content = append(result.Content, key, val)
+		}
+	}
+	return result
+}
+
+// expandNode expands environment references in all scalar values
+func expandNode(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		val, err := Expand(node.Value, os.LookupEnv)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		expanded := val != node.Value
+		node.Value = val
+		if expanded && node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.TaggedStyle) == 0 {
+			// allow the expanded value to resolve to a number or bool, but
+			// keep values such as "null" or "~" strings
+			node.Tag = ""
+			if node.ShortTag() == "!!null" {
+				node.Tag = "!!str"
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := expandNode(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode, yaml.DocumentNode:
+		for _, n := range node.Content {
+			if err := expandNode(n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Expand replaces ${VAR} and ${VAR:-default} references in s using lookup.
+// The default is used when VAR is unset or empty.  A reference to an unset
+// variable with no default is an error.  $${ produces a literal ${, and text
+// such as ${env:NAME} that is not a variable reference is left unchanged.
+func Expand(s string, lookup func(string) (string, bool)) (string, error) {
+	var sb strings.Builder
+	for {
+		idx := strings.Index(s, "${")
+		if idx < 0 {
+			break
+		}
+		if idx > 0 && s[idx-1] == '$' {
+			sb.WriteString(s[:idx])
+			sb.WriteString("{")
+			s = s[idx+2:]
+			continue
+		}
+		sb.WriteString(s[:idx])
+		s = s[idx+2:]
+		nameLen := varNameLen(s)
+		switch {
+		case nameLen > 0 && strings.HasPrefix(s[nameLen:], "}"):
+			val, ok := lookup(s[:nameLen])
+			if !ok {
+				return "", fmt.Errorf("environment variable %s not set", s[:nameLen])
+			}
+			sb.WriteString(val)
+			s = s[nameLen+1:]
+		case nameLen > 0 && strings.HasPrefix(s[nameLen:], ":-"):
+			end := strings.Index(s, "}")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated reference ${%s", s)
+			}
+			val, _ := lookup(s[:nameLen])
+			if val == "" {
+				val = s[nameLen+2 : end]
+			}
+			sb.WriteString(val)
+			s = s[end+1:]
+		default:
+			sb.WriteString("${")
+		}
+	}
+	sb.WriteString(s)
+	return sb.String(), nil
+}
+
+// varNameLen returns the length of the environment variable name at the
+// start of s
+func varNameLen(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return i
+	}
+	return len(s)
+}
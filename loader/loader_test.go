@@ -0,0 +1,232 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jfcote87/sshdb"
+	"github.com/jfcote87/sshdb/loader"
+)
+
+func TestLoadTunnelConfig(t *testing.T) {
+	t.Setenv("SSHDB_TEST_BASTION", "prod-bastion.example.com:22")
+	t.Setenv("SSHDB_TEST_MAX_CHANNELS", "")
+	cfg, err := loader.LoadTunnelConfig("../testfiles/loader/prod.yaml")
+	if err != nil {
+		t.Errorf("LoadTunnelConfig %v", err)
+		return
+	}
+	if cfg.HostPort != "prod-bastion.example.com:22" || cfg.UserID != "deploy" || cfg.Pwd != "${env:SSHDB_TEST_PWD}" {
+		t.Errorf("unexpected values %s %s %s", cfg.HostPort, cfg.UserID, cfg.Pwd)
+	}
+	if cfg.MaxChannels != 4 || time.Duration(cfg.KeepaliveInterval) != 15*time.Second {
+		t.Errorf("expected max_channels 4 and keepalive 15s; got %d %v", cfg.MaxChannels, time.Duration(cfg.KeepaliveInterval))
+	}
+	orders := cfg.Datasources["orders"]
+	if orders.MaxOpenConns != 10 || orders.DriverName != "test_driver" ||
+		orders.ConnectionString != "app:${env:ORDERS_PWD}@tcp(orders.internal:3306)/orders" {
+		t.Errorf("unexpected orders datasource %#v", orders)
+	}
+	if len(cfg.Datasources) != 3 || cfg.Datasources["archive"].ConnectionString != "archive_dsn_${literal}" {
+		t.Errorf("unexpected datasources %#v", cfg.Datasources)
+	}
+
+	t.Setenv("SSHDB_TEST_MAX_CHANNELS", "12")
+	cfg, err = loader.LoadTunnelConfig("../testfiles/loader/multi.json")
+	if err != nil {
+		t.Errorf("LoadTunnelConfig json %v", err)
+		return
+	}
+	if cfg.UserID != "json_user" || cfg.MaxChannels != 6 || cfg.Datasources["reports"].ConnectionString != "json_reports_dsn" ||
+		cfg.Datasources["reports"].DriverName != "test_driver" {
+		t.Errorf("unexpected json merge %#v", cfg)
+	}
+
+	for _, fn := range []string{"cycle.yaml", "missing.yaml", "doesnotexist.yaml", "base.txt"} {
+		if _, err := loader.LoadTunnelConfig("../testfiles/loader/" + fn); err == nil {
+			t.Errorf("%s expected error", fn)
+		}
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	t.Setenv("SSHDB_TEST_BASTION", "east.example.com:22")
+	src := `
+tunnels:
+  east:
+    hostport: ${SSHDB_TEST_BASTION}
+    user_id: ${SSHDB_TEST_USER:-me}
+    pwd: "${SSHDB_TEST_PWD:-123}"
+    datasources:
+      orders:
+        driver_name: test_driver
+        dsn: orders_dsn
+`
+	cfg, err := loader.ReadConfig(strings.NewReader(src), loader.YAML)
+	if err != nil {
+		t.Errorf("ReadConfig %v", err)
+		return
+	}
+	east := cfg.Tunnels["east"]
+	if east == nil || east.HostPort != "east.example.com:22" || east.UserID != "me" || east.Pwd != "123" {
+		t.Errorf("unexpected tunnel %#v", east)
+	}
+	jsonSrc := `{"hostport": "${SSHDB_TEST_BASTION}", "user_id": "me"}`
+	tc, err := loader.ReadTunnelConfig(strings.NewReader(jsonSrc), loader.JSON)
+	if err != nil || tc.HostPort != "east.example.com:22" {
+		t.Errorf("ReadTunnelConfig expected east.example.com:22; got %v", err)
+	}
+	if _, err := loader.ReadTunnelConfig(strings.NewReader("hostport: ssh.example.com:22"), loader.JSON); err == nil {
+		t.Errorf("expected json format error")
+	}
+	if _, err := loader.ReadTunnelConfig(strings.NewReader(jsonSrc), loader.Format("xml")); err == nil {
+		t.Errorf("expected unsupported format error")
+	}
+}
+
+func TestReadConfig_NullValues(t *testing.T) {
+	for _, v := range []string{"null", "~", ""} {
+		t.Setenv("SSHDB_TEST_USER", v)
+		tc, err := loader.ReadTunnelConfig(strings.NewReader("user_id: ${SSHDB_TEST_USER}\nmax_channels: ${SSHDB_TEST_UNSET_CHANNELS:-3}"), loader.YAML)
+		if err != nil || tc.UserID != v || tc.MaxChannels != 3 {
+			t.Errorf("expected user_id %q and max_channels 3; got %v", v, err)
+		}
+		t.Setenv("SSHDB_TEST_CHANNELS", v)
+		if _, err := loader.ReadTunnelConfig(strings.NewReader("max_channels: ${SSHDB_TEST_CHANNELS}"), loader.YAML); err == nil {
+			t.Errorf("expected error for max_channels %q", v)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{"HOST": "db.internal", "EMPTY": ""}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "no refs", want: "no refs"},
+		{in: "${HOST}:5432", want: "db.internal:5432"},
+		{in: "${PORT:-5432}", want: "5432"},
+		{in: "${EMPTY:-default}", want: "default"},
+		{in: "${HOST:-other}", want: "db.internal"},
+		{in: "pwd=${env:DB_PWD}", want: "pwd=${env:DB_PWD}"},
+		{in: "$${HOST}", want: "${HOST}"},
+		{in: "$HOST ${", want: "$HOST ${"},
+		{in: "${UNSET}", wantErr: true},
+		{in: "${UNSET:-x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := loader.Expand(tt.in, lookup)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s expected %q (err %v); got %q %v", tt.in, tt.want, tt.wantErr, got, err)
+		}
+	}
+}
+
+func TestLoadTunnelConfig_TOML(t *testing.T) {
+	cfg, err := loader.LoadTunnelConfig("../testfiles/loader/tunnel.toml")
+	if err != nil {
+		t.Errorf("LoadTunnelConfig %v", err)
+		return
+	}
+	if cfg.HostPort != "bastion.example.com:22" || cfg.UserID != "toml_user" || cfg.MaxChannels != 3 ||
+		time.Duration(cfg.KeepaliveInterval) != 20*time.Second {
+		t.Errorf("unexpected values %#v", cfg)
+	}
+	if len(cfg.JumpHosts) != 1 || cfg.JumpHosts[0].HostPort != "jump.example.com:22" || !cfg.JumpHosts[0].UseAgent {
+		t.Errorf("unexpected jump hosts %#v", cfg.JumpHosts)
+	}
+	reports := cfg.Datasources["reports"]
+	if reports.ConnectionString != "toml_reports_dsn" || reports.DriverName != "test_driver" || reports.MaxIdleConns != -1 {
+		t.Errorf("unexpected reports datasource %#v", reports)
+	}
+	if _, err := loader.ReadTunnelConfig(strings.NewReader("hostport = "), loader.TOML); err == nil {
+		t.Errorf("expected toml parse error")
+	}
+}
+
+func TestDecodeEnv(t *testing.T) {
+	environ := []string{
+		"SSHDB_HOSTPORT=bastion.example.com:22",
+		"SSHDB_USER_ID=deploy",
+		"SSHDB_PWD=123",
+		"SSHDB_CLIENT_KEY_FILE=/keys/id_ed25519",
+		"SSHDB_KEEPALIVE_INTERVAL=30s",
+		"SSHDB_MAX_CHANNELS=5",
+		"SSHDB_STRICT_HOST_KEY_CHECKING=true",
+		"SSHDB_SERVER_CA_KEYS=key1, key2",
+		"SSHDB_JUMP_HOSTS_1_HOSTPORT=jump2.example.com:22",
+		"SSHDB_JUMP_HOSTS_0_HOSTPORT=jump1.example.com:22",
+		"SSHDB_JUMP_HOSTS_0_USER_ID=jumper",
+		"SSHDB_DATASOURCES_ORDERS_DRIVER_NAME=mysql",
+		"SSHDB_DATASOURCES_ORDERS_DSN=app:${env:ORDERS_PWD}@tcp(orders.internal:3306)/orders",
+		"SSHDB_DATASOURCES_ORDERS_MAX_OPEN_CONNS=4",
+		"SSHDB_DATASOURCES_ORDER_ITEMS_DSN=items_dsn",
+		"SSHDB_KEYBOARD_INTERACTIVE_ANSWERS_PIN=1234",
+		"SSHDB_FORWARDS_PG_LOCAL_ADDR=127.0.0.1:15432",
+		"OTHER_HOSTPORT=ignored",
+	}
+	var cfg *sshdb.TunnelConfig
+	if err := loader.DecodeEnv(environ, "", &cfg); err != nil {
+		t.Errorf("DecodeEnv %v", err)
+		return
+	}
+	if cfg.HostPort != "bastion.example.com:22" || cfg.UserID != "deploy" || cfg.Pwd != "123" ||
+		cfg.ClientKeyFile != "/keys/id_ed25519" || time.Duration(cfg.KeepaliveInterval) != 30*time.Second ||
+		cfg.MaxChannels != 5 || !cfg.StrictHostKeyChecking {
+		t.Errorf("unexpected values %#v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.ServerCAKeys, []string{"key1", "key2"}) {
+		t.Errorf("unexpected server ca keys %v", cfg.ServerCAKeys)
+	}
+	wantJumps := []sshdb.JumpHostConfig{
+		{HostPort: "jump1.example.com:22", UserID: "jumper"},
+		{HostPort: "jump2.example.com:22"},
+	}
+	if !reflect.DeepEqual(cfg.JumpHosts, wantJumps) {
+		t.Errorf("expected jump hosts %#v; got %#v", wantJumps, cfg.JumpHosts)
+	}
+	wantDS := map[string]sshdb.Datasource{
+		"orders":      {DriverName: "mysql", ConnectionString: "app:${env:ORDERS_PWD}@tcp(orders.internal:3306)/orders", MaxOpenConns: 4},
+		"order_items": {ConnectionString: "items_dsn"},
+	}
+	if !reflect.DeepEqual(cfg.Datasources, wantDS) {
+		t.Errorf("expected datasources %#v; got %#v", wantDS, cfg.Datasources)
+	}
+	if cfg.KeyboardInteractive == nil || cfg.KeyboardInteractive.Answers["pin"] != "1234" {
+		t.Errorf("unexpected keyboard interactive %#v", cfg.KeyboardInteractive)
+	}
+	if cfg.Forwards["pg"].LocalAddr != "127.0.0.1:15432" {
+		t.Errorf("unexpected forwards %#v", cfg.Forwards)
+	}
+
+	for _, env := range [][]string{{"SSHDB_UNKNOWN_FIELD=x"}, {"OTHER_HOSTPORT=x"}, {"SSHDB_MAX_CHANNELS=many"}} {
+		var tc *sshdb.TunnelConfig
+		if err := loader.DecodeEnv(env, "SSHDB", &tc); err == nil {
+			t.Errorf("%v expected error", env)
+		}
+	}
+
+	var multi *sshdb.Config
+	if err := loader.DecodeEnv([]string{"APP_TUNNELS_EAST_HOSTPORT=east.example.com:22"}, "app", &multi); err != nil ||
+		multi.Tunnels["east"] == nil || multi.Tunnels["east"].HostPort != "east.example.com:22" {
+		t.Errorf("expected Config tunnel east; got %v", err)
+	}
+
+	t.Setenv("SSHDB_HOSTPORT", "env.example.com:22")
+	if tc, err := loader.LoadTunnelConfigFromEnv(""); err != nil || tc.HostPort != "env.example.com:22" {
+		t.Errorf("LoadTunnelConfigFromEnv expected env.example.com:22; got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package azuread provides for Azure SQL connections authenticated with
+// Azure AD via the sshdb package.  The dsn's fedauth parameter selects the
+// authentication method, e.g.
+//
+//	sqlserver://orders.database.windows.net?database=orders&fedauth=ActiveDirectoryServicePrincipal&user id=<client id>&password=<secret>
+//
+// See github.com/microsoft/go-mssqldb/azuread for supported methods.  The sql
+// connection is made via the tunnel while tokens are requested directly
+// from Azure AD, so the client must be able to reach the token endpoint.
+package azuread
+
+import (
+	"database/sql/driver"
+
+	"github.com/jfcote87/sshdb"
+	"github.com/jfcote87/sshdb/mssql"
+	"github.com/microsoft/go-mssqldb/azuread"
+)
+
+func init() {
+	// register name with sshdb
+	sshdb.RegisterDriver(driverName, TunnelDriver)
+}
+
+const driverName = azuread.DriverName
+
+// TunnelDriver creates Azure AD mssql connectors that connect via sshdb tunnels
+var TunnelDriver sshdb.Driver = tunnelDriver(driverName)
+
+// OpenConnector returns a new Azure AD connector that uses the dialer to open ssh channel
+// connections as the underlying network connections
+func (tun tunnelDriver) OpenConnector(dialer sshdb.Dialer, dsn string) (driver.Connector, error) {
+	return tun.OpenConnectorWithOptions(dialer, dsn, sshdb.ConnectorOptions{})
+}
+
+// OpenConnectorWithOptions returns a new Azure AD connector using the SessionInitSQL option
+func (tun tunnelDriver) OpenConnectorWithOptions(dialer sshdb.Dialer, dsn string, opts sshdb.ConnectorOptions) (driver.Connector, error) {
+	connector, err := azuread.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	mssql.SetConnectorOptions(connector, dialer, opts)
+	return connector, nil
+}
+
+type tunnelDriver string
+
+func (tun tunnelDriver) Name() string {
+	return string(tun)
+}
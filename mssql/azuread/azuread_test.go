@@ -0,0 +1,52 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package azuread_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/jfcote87/sshdb"
+	"github.com/jfcote87/sshdb/mssql/azuread"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+func TestTunnelDriver(t *testing.T) {
+	if azuread.TunnelDriver.Name() != "azuresql" {
+		t.Errorf("expected TunnelDriver.Name() = \"azuresql\"; got %s", azuread.TunnelDriver.Name())
+	}
+	if drv, err := (sshdb.Datasource{DriverName: "azuresql"}).Driver(); err != nil || drv != azuread.TunnelDriver {
+		t.Errorf("expected azuresql driver to be registered; got %v", err)
+	}
+	ctx, cancelfunc := context.WithCancel(context.Background())
+	defer cancelfunc()
+
+	var dialer sshdb.Dialer = sshdb.DialerFunc(func(ctxx context.Context, net, addr string) (net.Conn, error) {
+		cancelfunc()
+		return nil, errors.New("no connect")
+	})
+	if _, err := azuread.TunnelDriver.OpenConnector(dialer, "sqlserver://orders.database.windows.net?database=orders&fedauth=NotAMethod"); err == nil {
+		t.Errorf("expected invalid fedauth error; got <nil>")
+	}
+	// an ip address avoids a dns lookup by go-mssqldb prior to dialing
+	dsn := "sqlserver://10.1.2.3?database=orders&fedauth=ActiveDirectoryServicePrincipal&user+id=client-id@tenant-id&password=secret"
+	cx, err := azuread.TunnelDriver.(sshdb.OptionsDriver).OpenConnectorWithOptions(dialer, dsn, sshdb.ConnectorOptions{SessionInitSQL: "SET ANSI_NULLS ON"})
+	if err != nil {
+		t.Fatalf("open connector failed %v", err)
+	}
+	if c, ok := cx.(*mssql.Connector); !ok || c.SessionInitSQL != "SET ANSI_NULLS ON" {
+		t.Errorf("expected *mssql.Connector with SessionInitSQL; got %#v", cx)
+	}
+	_, err = cx.Connect(ctx)
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+	t.Errorf("expected dial via tunnel; got %v", err)
+}
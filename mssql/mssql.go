@@ -4,14 +4,20 @@
 // license that can be found in the LICENSE file.
 
 // Package mssql provides for mssql connection via the sshdb package
+// using github.com/microsoft/go-mssqldb.  TunnelDriver is an
+// sshdb.OptionsDriver so that SessionInitSQL may be set per datasource.
+// See the azuread subpackage for Azure AD authentication.
+//
+// go-mssqldb resolves the server's host name locally before dialing, so
+// the host must be an ip address or a name resolvable by the client.
 package mssql
 
 import (
 	"database/sql/driver"
 	"sync"
 
-	mssql "github.com/denisenkom/go-mssqldb"
 	"github.com/jfcote87/sshdb"
+	mssql "github.com/microsoft/go-mssqldb"
 )
 
 func init() {
@@ -27,16 +33,30 @@ var TunnelDriver sshdb.Driver = tunnelDriver(driverName)
 // OpenConnector returns a new mssql connector that uses the dialer to open ssh channel connections
 // as the underlying network connections
 func (tun tunnelDriver) OpenConnector(dialer sshdb.Dialer, dsn string) (driver.Connector, error) {
+	return tun.OpenConnectorWithOptions(dialer, dsn, sshdb.ConnectorOptions{})
+}
+
+// OpenConnectorWithOptions returns a new mssql connector using the SessionInitSQL option.
+// When the option is blank, the value set by SetSessionInitSQL is used.
+func (tun tunnelDriver) OpenConnectorWithOptions(dialer sshdb.Dialer, dsn string, opts sshdb.ConnectorOptions) (driver.Connector, error) {
 	connector, err := mssql.NewConnector(dsn)
 	if err != nil {
 		return nil, err
 	}
+	if opts.SessionInitSQL == "" {
+		mMap.Lock()
+		opts.SessionInitSQL = mapSessionInitSQL[dsn]
+		mMap.Unlock()
+	}
+	SetConnectorOptions(connector, dialer, opts)
+	return connector, nil
+}
 
+// SetConnectorOptions sets the connector's Dialer and SessionInitSQL.  Use to
+// create connectors from other go-mssqldb constructors.
+func SetConnectorOptions(connector *mssql.Connector, dialer sshdb.Dialer, opts sshdb.ConnectorOptions) {
 	connector.Dialer = mssql.Dialer(dialer)
-	mMap.Lock()
-	connector.SessionInitSQL = mapSessionInitSQL[dsn]
-	mMap.Unlock()
-	return connector, nil
+	connector.SessionInitSQL = opts.SessionInitSQL
 }
 
 type tunnelDriver string
@@ -49,7 +69,11 @@ var mapSessionInitSQL = make(map[string]string)
 var mMap sync.Mutex
 
 // SetSessionInitSQL will add the sql to the connector's SessionInitSQL
-// value whenever the dsn values match
+// value whenever the dsn values match.
+//
+// Deprecated: the dsn, including its password, is used as a key.  Use the
+// session_init_sql connector option of a Datasource or
+// Tunnel.OpenConnectorWithOptions.
 func SetSessionInitSQL(dsn, sql string) {
 	mMap.Lock()
 	defer mMap.Unlock()
@@ -0,0 +1,148 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Config describes multiple named tunnels so that an application's databases
+// may be defined in a single file and closed together.  Datasource names form
+// a single registry shared by the tunnels so that a name defined by only one
+// tunnel may be used alone.  Use loader.LoadConfig to read a Config from a
+// yaml, json or toml file.
+//
+//	tunnels:
+//	  east:
+//	    hostport: bastion-east.example.com:22
+//	    ...
+//	    datasources:
+//	      orders:
+//	        driver_name: mysql
+//	        dsn: ...
+//	  west:
+//	    ...
+type Config struct {
+	// map of tunnel names to TunnelConfigs
+	Tunnels map[string]*TunnelConfig `yaml:"tunnels,omitempty" json:"tunnels,omitempty"`
+}
+
+// DB returns the *sql.DB for name.  The name may be in the form "tunnel/datasource"
+// or may be a datasource name alone when only one tunnel defines a datasource
+// with that name.  A tunnel is opened on the first request for one of its
+// datasources.
+func (c *Config) DB(name string) (*sql.DB, error) {
+	tunnelName, dsName, err := c.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tunnels[tunnelName].DB(dsName)
+}
+
+// TunnelConfig returns the TunnelConfig with the passed name.
+func (c *Config) TunnelConfig(name string) (*TunnelConfig, error) {
+	tc := c.Tunnels[name]
+	if tc == nil {
+		return nil, &ConfigError{Idx: int(ErrTunnelNotFound), Msg: fmt.Sprintf("no tunnel named %s", name)}
+	}
+	return tc, nil
+}
+
+// DatasourceNames returns the sorted "tunnel/datasource" names of every
+// datasource in the config.
+func (c *Config) DatasourceNames() []string {
+	var names []string
+	for tunnelName, tc := range c.Tunnels {
+		if tc == nil {
+			continue
+		}
+		for dsName := range tc.Datasources {
+			names = append(names, tunnelName+"/"+dsName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve returns the tunnel and datasource names for name
+func (c *Config) resolve(name string) (string, string, error) {
+	if idx := strings.Index(name, "/"); idx >= 0 {
+		if _, err := c.TunnelConfig(name[:idx]); err != nil {
+			return "", "", err
+		}
+		return name[:idx], name[idx+1:], nil
+	}
+	var found []string
+	for tunnelName, tc := range c.Tunnels {
+		if tc == nil {
+			continue
+		}
+		if _, ok := tc.Datasources[name]; ok {
+			found = append(found, tunnelName)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", "", &ConfigError{Idx: int(ErrConfigDatasourceNotFound), Msg: fmt.Sprintf("datasource %s not found in any tunnel", name)}
+	case 1:
+		return found[0], name, nil
+	}
+	sort.Strings(found)
+	return "", "", &ConfigError{Idx: int(ErrAmbiguousDatasource), Msg: fmt.Sprintf("datasource %s is defined in tunnels %s; use the form tunnel/datasource",
+		name, strings.Join(found, ", "))}
+}
+
+// Close closes every *sql.DB and tunnel opened by the config and returns
+// the first error encountered.  See TunnelConfig.Close.
+func (c *Config) Close() error {
+	var err error
+	for _, tc := range c.Tunnels {
+		if tc == nil {
+			continue
+		}
+		if cerr := tc.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Validate checks each tunnel as described by TunnelConfig.Validate.  Paths
+// of the returned errors are prefixed with the tunnel name, e.g.
+// "tunnels.prod.datasources.orders.dsn".
+func (c *Config) Validate() error {
+	names := make([]string, 0, len(c.Tunnels))
+	for nm := range c.Tunnels {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	var errs ConfigErrors
+	for _, nm := range names {
+		tc := c.Tunnels[nm]
+		if tc == nil {
+			continue
+		}
+		tcErr := tc.Validate()
+		if tcErr == nil {
+			continue
+		}
+		for _, ce := range tcErr.(ConfigErrors) {
+			cx := *ce
+			cx.Path = "tunnels." + nm
+			if ce.Path > "" {
+				cx.Path += "." + ce.Path
+			}
+			errs = append(errs, &cx)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
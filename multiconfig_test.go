@@ -0,0 +1,86 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jfcote87/sshdb"
+	"github.com/jfcote87/sshdb/loader"
+)
+
+func TestConfig(t *testing.T) {
+	sshdb.RegisterDriver("test_driver", testDriver)
+	cfg, err := loader.LoadConfig("testfiles/multi/config.yaml")
+	if err != nil {
+		t.Errorf("LoadConfig %v", err)
+		return
+	}
+	defer cfg.Close()
+	want := []string{"east/orders", "east/reports", "west/inventory", "west/reports"}
+	if names := cfg.DatasourceNames(); !reflect.DeepEqual(names, want) {
+		t.Errorf("expected datasource names %v; got %v", want, names)
+	}
+
+	tests := []struct {
+		name    string
+		tunnel  string
+		ds      string
+		errIdx  int
+		wantErr bool
+	}{
+		{name: "east/orders", tunnel: "east", ds: "orders"},
+		{name: "orders", tunnel: "east", ds: "orders"},
+		{name: "inventory", tunnel: "west", ds: "inventory"},
+		{name: "west/reports", tunnel: "west", ds: "reports"},
+		{name: "east/reports", tunnel: "east", ds: "reports"},
+		{name: "reports", errIdx: 38, wantErr: true},
+		{name: "missing", errIdx: 37, wantErr: true},
+		{name: "north/orders", errIdx: 36, wantErr: true},
+		{name: "west/orders", errIdx: 21, wantErr: true},
+	}
+	for _, tt := range tests {
+		db, err := cfg.DB(tt.name)
+		if tt.wantErr {
+			var ce *sshdb.ConfigError
+			if !errors.As(err, &ce) || ce.Idx != tt.errIdx {
+				t.Errorf("%s expected ConfigError %d; got %v", tt.name, tt.errIdx, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s DB %v", tt.name, err)
+			continue
+		}
+		tc, err := cfg.TunnelConfig(tt.tunnel)
+		if err != nil {
+			t.Errorf("%s TunnelConfig %v", tt.name, err)
+			continue
+		}
+		if want, _ := tc.DB(tt.ds); want != db {
+			t.Errorf("%s expected db from tunnel %s", tt.name, tt.tunnel)
+		}
+	}
+
+	east, _ := cfg.DB("east/orders")
+	west, _ := cfg.DB("west/inventory")
+	if err := cfg.Close(); err != nil {
+		t.Errorf("Close %v", err)
+	}
+	for _, db := range []*sql.DB{east, west} {
+		if err := db.PingContext(context.Background()); err == nil || err.Error() != "sql: database is closed" {
+			t.Errorf("expected closed database; got %v", err)
+		}
+	}
+	var ce *sshdb.ConfigError
+	if _, err := cfg.DB("east/orders"); !errors.As(err, &ce) || ce.Idx != 39 {
+		t.Errorf("expected ConfigError 39 after Close; got %v", err)
+	}
+}
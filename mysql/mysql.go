@@ -45,6 +45,12 @@ func (tun tunnelDriver) OpenConnector(dialer sshdb.Dialer, dsn string) (driver.C
 	return mysql.NewConnector(cfg)
 }
 
+// ValidateDSN parses dsn without registering a dial func
+func (tun tunnelDriver) ValidateDSN(dsn string) error {
+	_, err := mysql.ParseDSN(dsn)
+	return err
+}
+
 type tunnelDriver string
 
 func (tun tunnelDriver) Name() string {
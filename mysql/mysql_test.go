@@ -56,6 +56,20 @@ func TestTunnelDriver(t *testing.T) {
 
 }
 
+func TestValidateDSN(t *testing.T) {
+	dv, ok := mysql.TunnelDriver.(sshdb.DSNValidator)
+	if !ok {
+		t.Errorf("expected TunnelDriver to implement sshdb.DSNValidator")
+		return
+	}
+	if err := dv.ValidateDSN("sa:passwordzzz(localhost:3306)schema"); err == nil {
+		t.Errorf("expected dsn parse error")
+	}
+	if err := dv.ValidateDSN("sa:password@tcp(localhost:3306)/schema"); err != nil {
+		t.Errorf("expected valid dsn; got %v", err)
+	}
+}
+
 const testEnvName = "SSHDB_CONFIG_YAML_TEST_MYSQL"
 
 func TestDriver_live(t *testing.T) {
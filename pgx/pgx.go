@@ -73,6 +73,12 @@ func (tun tunnelDriver) OpenConnector(df sshdb.Dialer, dsn string) (driver.Conne
 	}, nil
 }
 
+// ValidateDSN parses dsn without registering a driver config
+func (tun tunnelDriver) ValidateDSN(dsn string) error {
+	_, err := pgx.ParseConnectionString(dsn)
+	return err
+}
+
 type connector struct {
 	driver   *stdlib.Driver
 	nm       string
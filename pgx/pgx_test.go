@@ -52,6 +52,20 @@ func TestTunnelDriver(t *testing.T) {
 
 }
 
+func TestValidateDSN(t *testing.T) {
+	dv, ok := sshdbpgx.TunnelDriver.(sshdb.DSNValidator)
+	if !ok {
+		t.Errorf("expected TunnelDriver to implement sshdb.DSNValidator")
+		return
+	}
+	if err := dv.ValidateDSN("host=256.634.63.346.3 port=a"); err == nil {
+		t.Errorf("expected dsn parse error")
+	}
+	if err := dv.ValidateDSN("user=username password=password host=1.2.3.4 dbname=mydb"); err != nil {
+		t.Errorf("expected valid dsn; got %v", err)
+	}
+}
+
 type getConnConfig interface {
 	GetConnConfig() pgx.ConnConfig
 }
@@ -4,18 +4,26 @@
 // license that can be found in the LICENSE file.
 
 // Package pgxv4 provides for ssh postgres connections via
-// the "github.com/jackc/pgx/v4"
+// the "github.com/jackc/pgx/v4".  TunnelDriver creates database/sql
+// connectors while Connect and NewPool return a native *pgx.Conn or
+// *pgxpool.Pool.
 package pgxv4
 
 import (
+	"context"
 	"database/sql/driver"
+	"sync"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/jackc/pgx/v4/stdlib"
 	"github.com/jfcote87/sshdb"
 )
 
+var configFunc ConfigFunc
+var mConfigFunc sync.Mutex
+
 type tunnelDriver string
 
 func (tun tunnelDriver) Name() string {
@@ -25,16 +33,82 @@ func (tun tunnelDriver) Name() string {
 // TunnelDriver used to register an ssh tunnel for postgres
 var TunnelDriver sshdb.Driver = tunnelDriver("postgres_pgxv4")
 
+// ConfigFunc updates fields in a ConnConfig after
+// it is created by parsing the passed dsn.
+type ConfigFunc func(*pgx.ConnConfig) error
+
+// SetConfigEdit sets the ConfigFunc used to update the ConnConfig
+// created by OpenConnector, Connect and NewPool.  The DialFunc is
+// always replaced by the tunnel's dialer.
+func SetConfigEdit(cf ConfigFunc) {
+	mConfigFunc.Lock()
+	configFunc = cf
+	mConfigFunc.Unlock()
+}
+
+func (c ConfigFunc) edit(cc *pgx.ConnConfig) error {
+	if c == nil {
+		return nil
+	}
+	return c(cc)
+}
+
+// tunnelConfig applies the ConfigFunc and sets the DialFunc to df
+func tunnelConfig(df sshdb.Dialer, cfg *pgx.ConnConfig) error {
+	mConfigFunc.Lock()
+	cf := configFunc
+	mConfigFunc.Unlock()
+	if err := cf.edit(cfg); err != nil {
+		return err
+	}
+	cfg.DialFunc = pgconn.DialFunc(df.DialContext)
+	return nil
+}
+
 // OpenConnector returns a new database/sql/driver connector
 func (tun tunnelDriver) OpenConnector(df sshdb.Dialer, dsn string) (driver.Connector, error) {
 	cfg, err := pgx.ParseConfig(dsn)
 	if err != nil {
 		return nil, err
 	}
-
-	cfg.DialFunc = pgconn.DialFunc(df.DialContext)
+	if err := tunnelConfig(df, cfg); err != nil {
+		return nil, err
+	}
 	configName := stdlib.RegisterConnConfig(cfg)
 	// GetDefaultDriver always returns non-nil driver.DriverContext
 	return stdlib.GetDefaultDriver().(driver.DriverContext).OpenConnector(configName)
 
 }
+
+// ValidateDSN parses dsn without registering a connection config
+func (tun tunnelDriver) ValidateDSN(dsn string) error {
+	_, err := pgx.ParseConfig(dsn)
+	return err
+}
+
+// Connect returns a *pgx.Conn connected via df, usually a *sshdb.Tunnel.
+func Connect(ctx context.Context, df sshdb.Dialer, dsn string) (*pgx.Conn, error) {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := tunnelConfig(df, cfg); err != nil {
+		return nil, err
+	}
+	return pgx.ConnectConfig(ctx, cfg)
+}
+
+// NewPool returns a *pgxpool.Pool whose connections are made via df,
+// usually a *sshdb.Tunnel.  Pool settings such as pool_max_conns may be
+// included in the dsn.  As with pgxpool.Connect, a connection is
+// established before the pool is returned.
+func NewPool(ctx context.Context, df sshdb.Dialer, dsn string) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := tunnelConfig(df, cfg.ConnConfig); err != nil {
+		return nil, err
+	}
+	return pgxpool.ConnectConfig(ctx, cfg)
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pq provides for ssh postgres connections via
+// the github.com/lib/pq package.  NewListener creates a pq.Listener
+// for LISTEN/NOTIFY whose connections, including reconnects, are made
+// via a tunnel.
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"time"
+
+	"github.com/jfcote87/sshdb"
+	"github.com/lib/pq"
+)
+
+func init() {
+	// register name with sshdb
+	sshdb.RegisterDriver(driverName, TunnelDriver)
+}
+
+const driverName = "postgres_pq"
+
+// TunnelDriver creates lib/pq connectors that connect via sshdb tunnels
+var TunnelDriver sshdb.Driver = tunnelDriver(driverName)
+
+// OpenConnector returns a new pq connector that uses the dialer to open ssh channel connections
+// as the underlying network connections
+func (tun tunnelDriver) OpenConnector(dialer sshdb.Dialer, dsn string) (driver.Connector, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	connector.Dialer(Dialer(dialer))
+	return connector, nil
+}
+
+type tunnelDriver string
+
+func (tun tunnelDriver) Name() string {
+	return string(tun)
+}
+
+// Dialer returns a pq.Dialer that opens connections via dialer, usually
+// a *sshdb.Tunnel.  The returned value also implements pq.DialerContext.
+func Dialer(dialer sshdb.Dialer) pq.Dialer {
+	return pqDialer{dialer}
+}
+
+type pqDialer struct {
+	sshdb.Dialer
+}
+
+func (d pqDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d pqDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+// NewListener returns a pq.Listener whose connections are made via dialer,
+// usually a *sshdb.Tunnel.  name is the connection string of the database.
+// See pq.NewListener for the meaning of the remaining parameters.  When the
+// tunnel is reset, the listener reconnects through a new ssh connection and
+// re-issues its LISTEN commands.
+func NewListener(dialer sshdb.Dialer, name string, minReconnectInterval, maxReconnectInterval time.Duration, eventCallback pq.EventCallbackType) *pq.Listener {
+	return pq.NewDialListener(Dialer(dialer), name, minReconnectInterval, maxReconnectInterval, eventCallback)
+}
@@ -0,0 +1,265 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// NewProxyDialer returns a Dialer that connects to addresses through the proxy
+// server described by proxyURL.  Supported schemes are:
+//
+//	http://[user:pwd@]host:port     HTTP CONNECT
+//	https://[user:pwd@]host:port    HTTP CONNECT over a TLS connection to the proxy
+//	socks5://[user:pwd@]host:port   SOCKS5 with target names resolved locally
+//	socks5h://[user:pwd@]host:port  SOCKS5 with target names resolved by the proxy
+//
+// User info is sent as basic auth for http(s) and as username/password
+// authentication for socks5.  The connection to the proxy is made using forward,
+// or a net.Dialer if forward is nil.
+func NewProxyDialer(proxyURL string, forward Dialer) (Dialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url - %w", err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy url %s has no host", u.Redacted())
+	}
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	pd := &proxyDialer{
+		forward: forward,
+		scheme:  u.Scheme,
+		addr:    u.Host,
+		user:    u.User,
+	}
+	switch u.Scheme {
+	case "http":
+		pd.addr = defaultPort(u, "80")
+	case "https":
+		pd.addr = defaultPort(u, "443")
+	case "socks5", "socks5h":
+		pd.addr = defaultPort(u, "1080")
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	return pd, nil
+}
+
+func defaultPort(u *url.URL, port string) string {
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), port)
+	}
+	return u.Host
+}
+
+// proxyDialer establishes connections via an http or socks5 proxy
+type proxyDialer struct {
+	forward Dialer
+	scheme  string
+	addr    string // proxy host:port
+	user    *url.Userinfo
+}
+
+// DialContext connects to the proxy and requests a connection to addr.  ctx
+// bounds both the dial and the proxy handshake.
+func (pd *proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" {
+		return nil, fmt.Errorf("proxy: network %s not supported", network)
+	}
+	conn, err := pd.forward.DialContext(ctx, "tcp", pd.addr)
+	if err != nil {
+		return nil, err
+	}
+	if pd.scheme == "https" {
+		host, _, _ := net.SplitHostPort(pd.addr)
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// close conn to interrupt the handshake if ctx ends
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+	if pd.scheme == "socks5" || pd.scheme == "socks5h" {
+		err = pd.socksConnect(ctx, conn, addr)
+	} else {
+		conn, err = pd.httpConnect(conn, addr)
+	}
+	close(stop)
+	<-stopped
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		conn.Close()
+		return nil, ctxErr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect sends a CONNECT request for addr.  The returned conn includes
+// any bytes read past the proxy's response.
+func (pd *proxyDialer) httpConnect(conn net.Conn, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if pd.user != nil {
+		pwd, _ := pd.user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(pd.user.Username() + ":" + pwd))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return conn, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return conn, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return conn, fmt.Errorf("proxy: CONNECT %s failed - %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn returns data buffered while reading the proxy
+// response before reading from the underlying connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.r.Read(b)
+}
+
+// socksConnect performs a SOCKS5 CONNECT handshake (RFC 1928)
+func (pd *proxyDialer) socksConnect(ctx context.Context, conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 0xffff {
+		return fmt.Errorf("proxy: invalid port %s", portStr)
+	}
+	if pd.scheme == "socks5" && net.ParseIP(host) == nil {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return err
+		}
+		if len(ips) == 0 {
+			return fmt.Errorf("proxy: no addresses found for %s", host)
+		}
+		host = ips[0].IP.String()
+	}
+
+	method := byte(0x00)
+	if pd.user != nil {
+		method = 0x02
+	}
+	if _, err := conn.Write([]byte{0x05, 0x01, method}); err != nil {
+		return err
+	}
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[0] != 0x05 || resp[1] != method {
+		return errors.New("proxy: socks authentication method not accepted")
+	}
+	if method == 0x02 {
+		user := pd.user.Username()
+		pwd, _ := pd.user.Password()
+		if len(user) > 255 || len(pwd) > 255 {
+			return errors.New("proxy: socks username or password too long")
+		}
+		msg := append([]byte{0x01, byte(len(user))}, user...)
+		msg = append(append(msg, byte(len(pwd))), pwd...)
+		if _, err := conn.Write(msg); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return err
+		}
+		if resp[1] != 0x00 {
+			return errors.New("proxy: socks authentication failed")
+		}
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(append(req, 0x01), ip4...)
+		} else {
+			req = append(append(req, 0x04), ip...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("proxy: host name %s too long", host)
+		}
+		req = append(append(req, 0x03, byte(len(host))), host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return err
+	}
+	if hdr[1] != 0x00 {
+		return fmt.Errorf("proxy: socks connect to %s failed with reply code %d", addr, hdr[1])
+	}
+	// discard bound address
+	var skip int
+	switch hdr[3] {
+	case 0x01:
+		skip = net.IPv4len + 2
+	case 0x04:
+		skip = net.IPv6len + 2
+	case 0x03:
+		ln := make([]byte, 1)
+		if _, err := io.ReadFull(conn, ln); err != nil {
+			return err
+		}
+		skip = int(ln[0]) + 2
+	default:
+		return fmt.Errorf("proxy: socks reply has invalid address type %d", hdr[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
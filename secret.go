@@ -0,0 +1,242 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretResolver returns the secret identified by ref.  ref is the portion of
+// a secret placeholder following the scheme, e.g. "DB_PWD" for "${env:DB_PWD}".
+type SecretResolver interface {
+	ResolveSecret(ref string) (string, error)
+}
+
+// SecretResolverFunc allows a func to fulfill the SecretResolver interface.
+type SecretResolverFunc func(ref string) (string, error)
+
+// ResolveSecret calls the underlying func.
+func (f SecretResolverFunc) ResolveSecret(ref string) (string, error) {
+	return f(ref)
+}
+
+// secretCmdTimeout limits the run time of cmd: secret helpers
+const secretCmdTimeout = 30 * time.Second
+
+var secretResolvers = map[string]SecretResolver{
+	"env":  SecretResolverFunc(envSecret),
+	"file": SecretResolverFunc(fileSecret),
+	"cmd":  SecretResolverFunc(cmdSecret),
+}
+var mSecretResolvers sync.Mutex
+
+// RegisterSecretResolver associates a SecretResolver with scheme so that
+// placeholders in the form "${<scheme>:<ref>}" are resolved by r.  The env, file and
+// cmd schemes are registered by default and may be replaced.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	mSecretResolvers.Lock()
+	secretResolvers[scheme] = r
+	mSecretResolvers.Unlock()
+}
+
+func secretResolver(scheme string) SecretResolver {
+	mSecretResolvers.Lock()
+	defer mSecretResolvers.Unlock()
+	return secretResolvers[scheme]
+}
+
+// splitSecretRef returns the resolver and ref of a value in the form
+// "<scheme>:<ref>".  A nil resolver is returned if the scheme is not registered.
+func splitSecretRef(val string) (SecretResolver, string) {
+	idx := strings.Index(val, ":")
+	if idx < 1 {
+		return nil, ""
+	}
+	return secretResolver(val[:idx]), val[idx+1:]
+}
+
+// ResolveSecret returns the secret referenced by val when the entire value is
+// a placeholder in the form "${<scheme>:<ref>}" and scheme is registered, e.g.
+//
+//	${env:DB_PWD}                value of the DB_PWD environment variable
+//	${file:/run/secrets/db_pwd}  contents of the file without trailing newlines
+//	${cmd:pass show db/prod}     output of the command without trailing newlines
+//
+// Other values, including "env:DB_PWD" without the braces, are literals and
+// are returned unchanged.
+func ResolveSecret(val string) (string, error) {
+	r, ref := secretPlaceholder(val)
+	if r == nil {
+		return val, nil
+	}
+	return r.ResolveSecret(ref)
+}
+
+// secretPlaceholder returns the resolver and ref when the entire value of val
+// is a placeholder with a registered scheme.
+func secretPlaceholder(val string) (SecretResolver, string) {
+	if !strings.HasPrefix(val, "${") || !strings.HasSuffix(val, "}") {
+		return nil, ""
+	}
+	return splitSecretRef(val[2 : len(val)-1])
+}
+
+// ExpandSecrets replaces each ${<scheme>:<ref>} placeholder in s with the
+// referenced secret, e.g. "user:${env:DB_PWD}@tcp(db:3306)/app".  Placeholders
+// with an unregistered scheme are left unchanged.
+func ExpandSecrets(s string) (string, error) {
+	return expandSecrets(s, func(r SecretResolver, ref string) (string, error) {
+		return r.ResolveSecret(ref)
+	})
+}
+
+// checkSecrets reports whether s contains placeholders with a registered
+// scheme and returns an error if a placeholder has an empty ref.  Secrets are
+// not resolved.
+func checkSecrets(s string) (bool, error) {
+	found := false
+	_, err := expandSecrets(s, func(_ SecretResolver, ref string) (string, error) {
+		found = true
+		return "", checkSecretRef(ref)
+	})
+	return found, err
+}
+
+// checkSecretRef returns an error if ref is empty
+func checkSecretRef(ref string) error {
+	if strings.TrimSpace(ref) == "" {
+		return errors.New("secret placeholder has an empty reference")
+	}
+	return nil
+}
+
+// expandSecrets replaces each placeholder in s that has a registered scheme
+// with the value returned by resolve.
+func expandSecrets(s string, resolve func(SecretResolver, string) (string, error)) (string, error) {
+	var sb strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+		sb.WriteString(s[:start])
+		r, ref := splitSecretRef(s[start+2 : end])
+		if r == nil {
+			sb.WriteString(s[start : end+1])
+		} else {
+			secret, err := resolve(r, ref)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(secret)
+		}
+		s = s[end+1:]
+	}
+	sb.WriteString(s)
+	return sb.String(), nil
+}
+
+func envSecret(ref string) (string, error) {
+	val, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("secret env:%s not set", ref)
+	}
+	return val, nil
+}
+
+func fileSecret(ref string) (string, error) {
+	fn, err := expandHome(ref)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return "", fmt.Errorf("secret file:%s - %w", ref, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func cmdSecret(ref string) (string, error) {
+	args := strings.Fields(ref)
+	if len(args) == 0 {
+		return "", errors.New("secret cmd: no command specified")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretCmdTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	b, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("secret cmd:%s - %w", args[0], err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// secretValues holds the resolved secret fields of a TunnelConfig
+type secretValues struct {
+	pwd          string
+	clientKey    string
+	clientKeyPwd string
+}
+
+// secretFields returns the names and values of the secret fields
+func (tc *TunnelConfig) secretFields() []struct{ nm, val string } {
+	return []struct{ nm, val string }{
+		{nm: "pwd", val: tc.Pwd},
+		{nm: "client_key", val: tc.ClientKey},
+		{nm: "client_key_pwd", val: tc.ClientKeyPwd},
+	}
+}
+
+// resolveSecrets resolves the Pwd, ClientKey and ClientKeyPwd values
+func (tc *TunnelConfig) resolveSecrets() (*secretValues, error) {
+	var resolved []string
+	for _, fld := range tc.secretFields() {
+		secret, err := ResolveSecret(fld.val)
+		if err != nil {
+			return nil, tc.newErr(ErrSecret, fld.nm, "", fmt.Sprintf("%s secret error: %v", fld.nm, err)).setErr(err)
+		}
+		resolved = append(resolved, secret)
+	}
+	return &secretValues{pwd: resolved[0], clientKey: resolved[1], clientKeyPwd: resolved[2]}, nil
+}
+
+// secretErrors checks the placeholders of the secret fields without resolving
+// them and returns an error for every malformed placeholder.  The literal field
+// values are returned, or nil if the client key or its password is a
+// placeholder as the key may not be checked without its secrets.
+func (tc *TunnelConfig) secretErrors() (*secretValues, ConfigErrors) {
+	var errs ConfigErrors
+	literal := true
+	for _, fld := range tc.secretFields() {
+		r, ref := secretPlaceholder(fld.val)
+		if r == nil {
+			continue
+		}
+		if fld.nm != "pwd" {
+			literal = false
+		}
+		if err := checkSecretRef(ref); err != nil {
+			errs = append(errs, tc.newErr(ErrSecret, fld.nm, "", fmt.Sprintf("%s secret error: %v", fld.nm, err)).setErr(err))
+		}
+	}
+	if !literal {
+		return nil, errs
+	}
+	return &secretValues{pwd: tc.Pwd, clientKey: tc.ClientKey, clientKeyPwd: tc.ClientKeyPwd}, errs
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jfcote87/sshdb"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("SSHDB_TEST_SECRET", "env_secret")
+	fn := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(fn, []byte("file_secret\n"), 0600); err != nil {
+		t.Errorf("write secret file %v", err)
+		return
+	}
+	sshdb.RegisterSecretResolver("test", sshdb.SecretResolverFunc(func(ref string) (string, error) {
+		if ref == "missing" {
+			return "", errors.New("not found")
+		}
+		return strings.ToUpper(ref), nil
+	}))
+
+	tests := []struct {
+		val     string
+		want    string
+		wantErr bool
+	}{
+		{val: "plain_password", want: "plain_password"},
+		{val: "unknown:value", want: "unknown:value"},
+		{val: "${unknown:value}", want: "${unknown:value}"},
+		{val: "env:SSHDB_TEST_SECRET", want: "env:SSHDB_TEST_SECRET"},
+		{val: "file:" + fn, want: "file:" + fn},
+		{val: "cmd:echo cmd_secret", want: "cmd:echo cmd_secret"},
+		{val: "pre${env:SSHDB_TEST_SECRET}", want: "pre${env:SSHDB_TEST_SECRET}"},
+		{val: "${env:SSHDB_TEST_SECRET}", want: "env_secret"},
+		{val: "${env:SSHDB_TEST_UNSET}", wantErr: true},
+		{val: "${file:" + fn + "}", want: "file_secret"},
+		{val: "${file:" + fn + ".missing}", wantErr: true},
+		{val: "${cmd:echo cmd_secret}", want: "cmd_secret"},
+		{val: "${cmd:}", wantErr: true},
+		{val: "${test:vault_secret}", want: "VAULT_SECRET"},
+		{val: "${test:missing}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sshdb.ResolveSecret(tt.val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s expected error = %v; got %v", tt.val, tt.wantErr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s expected %q; got %q", tt.val, tt.want, got)
+		}
+	}
+
+	dsn, err := sshdb.ExpandSecrets("user:${env:SSHDB_TEST_SECRET}@tcp(${test:db}:3306)/${other:x}?a={b}")
+	if want := "user:env_secret@tcp(DB:3306)/${other:x}?a={b}"; err != nil || dsn != want {
+		t.Errorf("expected %s; got %s %v", want, dsn, err)
+	}
+	if _, err := sshdb.ExpandSecrets("user:${test:missing}@db"); err == nil {
+		t.Errorf("expected ExpandSecrets error")
+	}
+}
+
+func TestTunnelConfig_Secrets(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9261", "localhost:9262"
+	_, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		userID: "me",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: getPasswordServerCfg(func(b []byte) bool { return string(b) == "secretpwd" }),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+
+	sshdb.RegisterDriver("test_driver", testDriver)
+	t.Setenv("SSHDB_TEST_PWD", "secretpwd")
+	t.Setenv("SSHDB_TEST_DBHOST", "localhost")
+	cfg := &sshdb.TunnelConfig{
+		HostPort:        remoteAddr,
+		UserID:          "me",
+		Pwd:             "${env:SSHDB_TEST_PWD}",
+		ServerPublicKey: string(ssh.MarshalAuthorizedKey(serverSigner.PublicKey())),
+		Datasources: map[string]sshdb.Datasource{
+			"db": {DriverName: "test_driver", ConnectionString: "${env:SSHDB_TEST_DBHOST}:9262"},
+		},
+	}
+	defer cfg.Close()
+	db, err := cfg.DB("db")
+	if err != nil {
+		t.Errorf("DB %v", err)
+		return
+	}
+	if err := db.Ping(); err != nil {
+		t.Errorf("ping %v", err)
+	}
+	if cfg.Pwd != "${env:SSHDB_TEST_PWD}" {
+		t.Errorf("expected config Pwd to remain a reference; got %s", cfg.Pwd)
+	}
+
+	var ce *sshdb.ConfigError
+	for _, tc := range []*sshdb.TunnelConfig{
+		{HostPort: remoteAddr, UserID: "me", Pwd: "${env:SSHDB_TEST_UNSET}",
+			Datasources: map[string]sshdb.Datasource{"db": {DriverName: "test_driver", ConnectionString: "localhost:9262"}}},
+		{HostPort: remoteAddr, UserID: "me", Pwd: "secretpwd",
+			Datasources: map[string]sshdb.Datasource{"db": {DriverName: "test_driver", ConnectionString: "${env:SSHDB_TEST_UNSET}:9262"}}},
+	} {
+		if _, err := tc.DatabaseMap(); !errors.As(err, &ce) || ce.Idx != 40 {
+			t.Errorf("expected ConfigError 40; got %v", err)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package socks provides a SOCKS5 proxy server (RFC 1928) whose outbound
+// connections are made via an sshdb.Tunnel, similar to ssh -D.  Only the
+// CONNECT command is supported.  Clients may be required to authenticate
+// using username/password authentication (RFC 1929).
+//
+// A target may be a unix socket on the remote server by sending the socket
+// path as a domain name, e.g. "/var/run/mysqld/mysqld.sock" with port 0.
+package socks
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfcote87/sshdb"
+)
+
+// DefaultHandshakeTimeout limits the time a client may take to
+// negotiate a connection when Server.HandshakeTimeout is zero.
+const DefaultHandshakeTimeout = 30 * time.Second
+
+const (
+	socksVersion = 0x05
+	authVersion  = 0x01
+
+	methodNoAuth       = 0x00
+	methodUserPass     = 0x02
+	methodNoAcceptable = 0xff
+
+	cmdConnect = 0x01
+
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+
+	repSuccess             = 0x00
+	repGeneralFailure      = 0x01
+	repNotAllowed          = 0x02
+	repCmdNotSupported     = 0x07
+	repAddrTypeUnsupported = 0x08
+)
+
+// Server is a SOCKS5 proxy server.  Outbound connections are made with
+// Dialer, usually an *sshdb.Tunnel, and must match a pattern in Allow.
+type Server struct {
+	// Dialer creates connections to the requested targets
+	Dialer sshdb.Dialer
+	// Credentials maps usernames to passwords.  If not nil, clients must
+	// authenticate using username/password authentication.
+	Credentials map[string]string
+	// Allow lists the "host:port" patterns that clients may connect to.  Host
+	// and port are matched separately using path.Match, e.g. "db.internal:5432",
+	// "*.internal:*" or "10.1.2.*:3306".  Unix socket targets are cleaned and
+	// matched against the full pattern, e.g. "/var/run/*/*.sock"; targets
+	// containing ".." are denied.  An empty list denies all
+	// connections so that the server cannot become an open proxy.
+	Allow []string
+	// HandshakeTimeout limits negotiation time.  DefaultHandshakeTimeout
+	// is used when zero.
+	HandshakeTimeout time.Duration
+}
+
+// Serve accepts connections on l and handles each in a new go routine.  When ctx
+// is done, l is closed and ctx.Err() is returned. Otherwise, Serve returns the
+// listener's Accept error.  Active connections are closed before Serve returns.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	if s.Dialer == nil {
+		return errors.New("socks: nil Dialer")
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var m sync.Mutex
+	conns := make(map[net.Conn]bool)
+	go func() {
+		<-ctx.Done()
+		l.Close()
+		m.Lock()
+		for c := range conns {
+			c.Close()
+		}
+		m.Unlock()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return err
+		}
+		m.Lock()
+		conns[conn] = true
+		m.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = s.ServeConn(ctx, conn)
+			m.Lock()
+			delete(conns, conn)
+			m.Unlock()
+		}()
+	}
+}
+
+// ServeConn negotiates a SOCKS5 CONNECT request on conn and pipes data
+// between conn and the target until either side closes.  conn is closed
+// on return.
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+	timeout := s.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if err := s.negotiate(conn); err != nil {
+		return err
+	}
+	addr, err := readRequest(conn)
+	if err != nil {
+		var re replyError
+		if errors.As(err, &re) {
+			_ = writeReply(conn, byte(re))
+		}
+		return err
+	}
+	if !s.allowed(addr) {
+		_ = writeReply(conn, repNotAllowed)
+		return fmt.Errorf("socks: %s not allowed", addr)
+	}
+	dctx, cancel := context.WithTimeout(ctx, timeout)
+	target, err := s.Dialer.DialContext(dctx, "tcp", addr)
+	cancel()
+	if err != nil {
+		_ = writeReply(conn, repGeneralFailure)
+		return err
+	}
+	defer target.Close()
+	if err := writeReply(conn, repSuccess); err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(target, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, target)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	conn.Close()
+	target.Close()
+	return nil
+}
+
+// negotiate selects an authentication method and authenticates the client
+func (s *Server) negotiate(conn net.Conn) error {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return err
+	}
+	if hdr[0] != socksVersion {
+		return fmt.Errorf("socks: unsupported version %d", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+	want := byte(methodNoAuth)
+	if s.Credentials != nil {
+		want = methodUserPass
+	}
+	for _, m := range methods {
+		if m == want {
+			if _, err := conn.Write([]byte{socksVersion, want}); err != nil {
+				return err
+			}
+			if want == methodUserPass {
+				return s.authenticate(conn)
+			}
+			return nil
+		}
+	}
+	_, _ = conn.Write([]byte{socksVersion, methodNoAcceptable})
+	return errors.New("socks: no acceptable authentication method")
+}
+
+// authenticate handles RFC 1929 username/password authentication
+func (s *Server) authenticate(conn net.Conn) error {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return err
+	}
+	if hdr[0] != authVersion {
+		return fmt.Errorf("socks: unsupported auth version %d", hdr[0])
+	}
+	user := make([]byte, int(hdr[1])+1) // includes password length
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return err
+	}
+	pwd := make([]byte, user[len(user)-1])
+	if _, err := io.ReadFull(conn, pwd); err != nil {
+		return err
+	}
+	expected, ok := s.Credentials[string(user[:len(user)-1])]
+	if !ok || subtle.ConstantTimeCompare([]byte(expected), pwd) != 1 {
+		_, _ = conn.Write([]byte{authVersion, 0x01})
+		return errors.New("socks: authentication failed")
+	}
+	_, err := conn.Write([]byte{authVersion, 0x00})
+	return err
+}
+
+// replyError is a request error that should be reported to the client
+type replyError byte
+
+func (r replyError) Error() string {
+	return fmt.Sprintf("socks: request failed with reply code %d", byte(r))
+}
+
+// readRequest reads a CONNECT request and returns the target address
+func readRequest(conn net.Conn) (string, error) {
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return "", err
+	}
+	if hdr[0] != socksVersion {
+		return "", fmt.Errorf("socks: unsupported version %d", hdr[0])
+	}
+	var host string
+	switch hdr[3] {
+	case atypIPv4, atypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if hdr[3] == atypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case atypDomain:
+		ln := make([]byte, 1)
+		if _, err := io.ReadFull(conn, ln); err != nil {
+			return "", err
+		}
+		domain := make([]byte, ln[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", replyError(repAddrTypeUnsupported)
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	if hdr[1] != cmdConnect {
+		return "", replyError(repCmdNotSupported)
+	}
+	if strings.HasPrefix(host, "/") {
+		// unix socket target
+		return unixTarget(host)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1]))), nil
+}
+
+// unixTarget returns the cleaned socket path.  Paths containing ".."
+// elements are not allowed as they may escape an Allow pattern.
+func unixTarget(host string) (string, error) {
+	for _, elem := range strings.Split(host, "/") {
+		if elem == ".." {
+			return "", replyError(repNotAllowed)
+		}
+	}
+	cleaned := path.Clean(host)
+	if !path.IsAbs(cleaned) {
+		return "", replyError(repNotAllowed)
+	}
+	return cleaned, nil
+}
+
+// writeReply sends a reply with an unspecified bound address
+func writeReply(conn net.Conn, rep byte) error {
+	_, err := conn.Write([]byte{socksVersion, rep, 0x00, atypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// allowed reports whether addr matches an Allow pattern
+func (s *Server) allowed(addr string) bool {
+	for _, pattern := range s.Allow {
+		if strings.HasPrefix(addr, "/") {
+			if ok, _ := path.Match(pattern, addr); ok {
+				return true
+			}
+			continue
+		}
+		phost, pport, err := net.SplitHostPort(pattern)
+		if err != nil {
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return false
+		}
+		hostOK, _ := path.Match(strings.ToLower(phost), strings.ToLower(host))
+		portOK, _ := path.Match(pport, port)
+		if hostOK && portOK {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package socks_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jfcote87/sshdb"
+	"github.com/jfcote87/sshdb/socks"
+)
+
+// echoDialer returns an in-memory echo connection for each dial
+// and records the dialed addresses
+type echoDialer struct {
+	m     sync.Mutex
+	addrs []string
+}
+
+func (ed *echoDialer) DialContext(ctx context.Context, _, addr string) (net.Conn, error) {
+	ed.m.Lock()
+	ed.addrs = append(ed.addrs, addr)
+	ed.m.Unlock()
+	if addr == "fail.internal:5432" {
+		return nil, errors.New("dial failed")
+	}
+	c1, c2 := net.Pipe()
+	go func() {
+		_, _ = io.Copy(c2, c2)
+		c2.Close()
+	}()
+	return c1, nil
+}
+
+func TestServer(t *testing.T) {
+	dialer := &echoDialer{}
+	srv := &socks.Server{
+		Dialer: dialer,
+		Allow:  []string{"db.internal:5432", "fail.internal:*", "10.1.2.*:3306", "/var/run/*/*.sock"},
+	}
+	authSrv := &socks.Server{
+		Dialer:      dialer,
+		Credentials: map[string]string{"me": "secret"},
+		Allow:       []string{"*:*"},
+	}
+	tests := []struct {
+		name     string
+		srv      *socks.Server
+		user     string
+		pwd      string
+		cmd      byte
+		host     string
+		port     int
+		authFail bool
+		reply    byte
+	}{
+		{name: "domain", srv: srv, host: "db.internal", port: 5432},
+		{name: "ipv4", srv: srv, host: "10.1.2.3", port: 3306},
+		{name: "unix", srv: srv, host: "/var/run/mysqld/mysqld.sock"},
+		{name: "denied_host", srv: srv, host: "other.internal", port: 5432, reply: 0x02},
+		{name: "denied_port", srv: srv, host: "10.1.2.3", port: 22, reply: 0x02},
+		{name: "denied_unix", srv: srv, host: "/etc/passwd", reply: 0x02},
+		{name: "denied_unix_traversal", srv: srv, host: "/var/run/../x.sock", reply: 0x02},
+		{name: "denied_unix_nested_traversal", srv: srv, host: "/var/run/mysqld/../../../etc/x.sock", reply: 0x02},
+		{name: "unix_cleaned", srv: srv, host: "/var/run//mysqld/./mysqld.sock"},
+		{name: "dial_fail", srv: srv, host: "fail.internal", port: 5432, reply: 0x01},
+		{name: "bind", srv: srv, cmd: 0x02, host: "db.internal", port: 5432, reply: 0x07},
+		{name: "auth", srv: authSrv, user: "me", pwd: "secret", host: "any.example.com", port: 80},
+		{name: "auth_fail", srv: authSrv, user: "me", pwd: "wrong", host: "any.example.com", port: 80, authFail: true},
+		{name: "auth_missing", srv: authSrv, host: "any.example.com", port: 80, authFail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			go tt.srv.ServeConn(context.Background(), server)
+			reply, err := connect(client, tt.user, tt.pwd, tt.cmd, tt.host, tt.port)
+			if tt.authFail {
+				if err == nil {
+					t.Errorf("expected authentication failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("connect failed %v", err)
+				return
+			}
+			if reply != tt.reply {
+				t.Errorf("expected reply %d; got %d", tt.reply, reply)
+				return
+			}
+			if reply != 0 {
+				return
+			}
+			msg := []byte("ping through tunnel")
+			if _, err := client.Write(msg); err != nil {
+				t.Errorf("write failed %v", err)
+				return
+			}
+			buf := make([]byte, len(msg))
+			if _, err := io.ReadFull(client, buf); err != nil || string(buf) != string(msg) {
+				t.Errorf("expected echo %q; got %q %v", msg, buf, err)
+			}
+		})
+	}
+	expectedAddrs := []string{"db.internal:5432", "10.1.2.3:3306", "/var/run/mysqld/mysqld.sock", "/var/run/mysqld/mysqld.sock", "fail.internal:5432", "any.example.com:80"}
+	if len(dialer.addrs) != len(expectedAddrs) {
+		t.Errorf("expected dials %v; got %v", expectedAddrs, dialer.addrs)
+		return
+	}
+	for i, addr := range expectedAddrs {
+		if dialer.addrs[i] != addr {
+			t.Errorf("expected dial %d to %s; got %s", i, addr, dialer.addrs[i])
+		}
+	}
+}
+
+func TestServer_Serve(t *testing.T) {
+	srv := &socks.Server{}
+	if err := srv.Serve(context.Background(), nil); err == nil {
+		t.Errorf("expected nil Dialer error")
+	}
+	srv = &socks.Server{
+		Dialer: sshdb.DialerFunc((&echoDialer{}).DialContext),
+		Allow:  []string{"*:*"},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Errorf("listen failed %v", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ctx, l)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Errorf("dial failed %v", err)
+		cancel()
+		return
+	}
+	defer conn.Close()
+	if reply, err := connect(conn, "", "", 0, "db.example.com", 5432); err != nil || reply != 0 {
+		t.Errorf("expected successful connect; got %d %v", reply, err)
+	}
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("expected context.Canceled; got %v", err)
+	}
+	// active connections are closed by Serve
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("expected closed connection")
+	}
+}
+
+// connect performs a client SOCKS5 negotiation and returns the
+// server's reply code.
+func connect(conn net.Conn, user, pwd string, cmd byte, host string, port int) (byte, error) {
+	method := byte(0x00)
+	if user > "" {
+		method = 0x02
+	}
+	if _, err := conn.Write([]byte{0x05, 0x01, method}); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return 0, err
+	}
+	if resp[1] != method {
+		return 0, errors.New("method rejected")
+	}
+	if method == 0x02 {
+		msg := append([]byte{0x01, byte(len(user))}, user...)
+		msg = append(append(msg, byte(len(pwd))), pwd...)
+		if _, err := conn.Write(msg); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return 0, err
+		}
+		if resp[1] != 0x00 {
+			return 0, errors.New("authentication failed")
+		}
+	}
+	if cmd == 0 {
+		cmd = 0x01
+	}
+	req := []byte{0x05, cmd, 0x00}
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		req = append(append(req, 0x01), ip...)
+	} else {
+		req = append(append(req, 0x03, byte(len(host))), host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return 0, err
+	}
+	return reply[1], nil
+}
@@ -0,0 +1,448 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSSHConfigFile is the OpenSSH client config file used when
+// no file is specified.
+const DefaultSSHConfigFile = "~/.ssh/config"
+
+// maxIncludeDepth limits recursive Include directives
+const maxIncludeDepth = 16
+
+// LoadSSHConfig returns a TunnelConfig for the Host alias defined in the OpenSSH
+// client config file fn (DefaultSSHConfigFile when empty).  The HostName, Port, User,
+// IdentityFile, ProxyJump and UserKnownHostsFile keywords are used.  Hosts named in
+// ProxyJump are resolved as aliases as well, although their own ProxyJump values are
+// ignored.  Host patterns may contain the '*', '?' and '!' wildcards, and Include
+// directives are followed.  Relative Include paths are relative to the directory of
+// fn.  Match blocks are not supported and are skipped.
+//
+// As with OpenSSH, the first value found for a keyword is used, HostName defaults to
+// the alias and the ssh-agent is used when no IdentityFile is specified.  Every file
+// listed by UserKnownHostsFile is used, defaulting to ~/.ssh/known_hosts and
+// ~/.ssh/known_hosts2, and KnownHostsFile lists them separated by
+// os.PathListSeparator.  Datasources and Forwards must be added by the caller.
+func LoadSSHConfig(fn, alias string) (*TunnelConfig, error) {
+	p, err := newSSHConfigParser(fn)
+	if err != nil {
+		return nil, err
+	}
+	h, err := p.host(alias, "", "")
+	if err != nil {
+		return nil, err
+	}
+	tc := &TunnelConfig{
+		HostPort:       h.hostPort(),
+		UserID:         h.user,
+		ClientKeyFile:  h.identityFile,
+		KnownHostsFile: h.knownHostsFile(),
+		UseAgent:       h.identityFile == "",
+	}
+	if h.proxyJump == "" || h.proxyJump == "none" {
+		return tc, nil
+	}
+	for _, jump := range strings.Split(h.proxyJump, ",") {
+		jh, err := p.jumpHost(strings.TrimSpace(jump))
+		if err != nil {
+			return nil, err
+		}
+		tc.JumpHosts = append(tc.JumpHosts, jh)
+	}
+	return tc, nil
+}
+
+// resolvedConfig returns the config with fields that are not explicitly set
+// filled from the SSHConfigHost entry.  The ssh config file is read on each
+// call so that edits are used by Reopen.  tc is not modified; when
+// SSHConfigHost is set, the values are filled in a copy.
+func (tc *TunnelConfig) resolvedConfig() (*TunnelConfig, error) {
+	if tc.SSHConfigHost == "" {
+		return tc, nil
+	}
+	sc, err := LoadSSHConfig(tc.SSHConfigFile, tc.SSHConfigHost)
+	if err != nil {
+		return nil, tc.newErr(ErrSSHConfig, "ssh_config_host", "", fmt.Sprintf("ssh config host %s error: %v", tc.SSHConfigHost, err)).setErr(err)
+	}
+	rc := tc.settings()
+	if rc.HostPort == "" {
+		rc.HostPort = sc.HostPort
+	}
+	if rc.UserID == "" {
+		rc.UserID = sc.UserID
+	}
+	if rc.ClientKey+rc.ClientKeyFile == "" {
+		rc.ClientKeyFile = sc.ClientKeyFile
+		// OpenSSH uses the agent when no identity file is given
+		rc.UseAgent = rc.UseAgent || (sc.UseAgent && rc.Pwd == "")
+	}
+	if rc.KnownHostsFile == "" {
+		rc.KnownHostsFile = sc.KnownHostsFile
+	}
+	if len(rc.JumpHosts) == 0 {
+		rc.JumpHosts = sc.JumpHosts
+	}
+	return rc, nil
+}
+
+// settings returns a new TunnelConfig with the exported fields and error
+// path prefix of tc.  Maps and slices are shared with tc.
+func (tc *TunnelConfig) settings() *TunnelConfig {
+	return &TunnelConfig{
+		SSHConfigHost:         tc.SSHConfigHost,
+		SSHConfigFile:         tc.SSHConfigFile,
+		HostPort:              tc.HostPort,
+		UserID:                tc.UserID,
+		Pwd:                   tc.Pwd,
+		ClientKeyFile:         tc.ClientKeyFile,
+		ClientKey:             tc.ClientKey,
+		ClientKeyPwd:          tc.ClientKeyPwd,
+		ClientCertFile:        tc.ClientCertFile,
+		ClientCert:            tc.ClientCert,
+		ServerPublicKeyFile:   tc.ServerPublicKeyFile,
+		ServerPublicKey:       tc.ServerPublicKey,
+		KnownHostsFile:        tc.KnownHostsFile,
+		TrustOnFirstUse:       tc.TrustOnFirstUse,
+		StrictHostKeyChecking: tc.StrictHostKeyChecking,
+		ServerCAKeyFile:       tc.ServerCAKeyFile,
+		ServerCAKeys:          tc.ServerCAKeys,
+		KeyboardInteractive:   tc.KeyboardInteractive,
+		ChallengeResponder:    tc.ChallengeResponder,
+		UseAgent:              tc.UseAgent,
+		AgentSocket:           tc.AgentSocket,
+		IgnoreDeadlines:       tc.IgnoreDeadlines,
+		Datasources:           tc.Datasources,
+		JumpHosts:             tc.JumpHosts,
+		KeepaliveInterval:     tc.KeepaliveInterval,
+		KeepaliveMaxMissed:    tc.KeepaliveMaxMissed,
+		Forwards:              tc.Forwards,
+		ProxyURL:              tc.ProxyURL,
+		MaxChannels:           tc.MaxChannels,
+		pathPrefix:            tc.pathPrefix,
+	}
+}
+
+// defaultKnownHostsFiles are the OpenSSH UserKnownHostsFile defaults
+var defaultKnownHostsFiles = []string{"~/.ssh/known_hosts", "~/.ssh/known_hosts2"}
+
+// sshConfigHost contains the resolved values for a host
+type sshConfigHost struct {
+	hostName        string
+	port            string
+	user            string
+	identityFile    string
+	proxyJump       string
+	knownHostsFiles []string
+}
+
+// knownHostsFile returns the known hosts files joined for use as a
+// KnownHostsFile value
+func (h *sshConfigHost) knownHostsFile() string {
+	return strings.Join(h.knownHostsFiles, string(os.PathListSeparator))
+}
+
+func (h *sshConfigHost) hostPort() string {
+	port := h.port
+	if port == "" {
+		port = "22"
+	}
+	return net.JoinHostPort(h.hostName, port)
+}
+
+// sshConfigLine is a keyword and its arguments along with the Host
+// patterns in effect for the line
+type sshConfigLine struct {
+	patterns []string
+	keyword  string // lower case
+	args     []string
+}
+
+type sshConfigParser struct {
+	dir   string // directory for relative Include paths
+	home  string
+	lines []sshConfigLine
+}
+
+func newSSHConfigParser(fn string) (*sshConfigParser, error) {
+	if fn == "" {
+		fn = DefaultSSHConfigFile
+	}
+	fn, err := expandHome(fn)
+	if err != nil {
+		return nil, err
+	}
+	home, _ := os.UserHomeDir()
+	p := &sshConfigParser{dir: filepath.Dir(fn), home: home}
+	if err := p.readFile(fn, []string{"*"}, 0); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// readFile appends the lines of fn to p.lines.  patterns contains the Host
+// patterns in effect at the start of the file and are restored after an
+// included file is read.
+func (p *sshConfigParser) readFile(fn string, patterns []string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("ssh config: include depth exceeded at %s", fn)
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		keyword, args, err := splitSSHConfigLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("ssh config: %s line %d - %v", fn, lineNo, err)
+		}
+		switch keyword {
+		case "":
+		case "host":
+			patterns = args
+		case "match":
+			// Match blocks are unsupported, so their lines never apply
+			patterns = nil
+		case "include":
+			for _, arg := range args {
+				if err := p.include(arg, patterns, depth); err != nil {
+					return err
+				}
+			}
+		default:
+			p.lines = append(p.lines, sshConfigLine{patterns: patterns, keyword: keyword, args: args})
+		}
+	}
+	return scanner.Err()
+}
+
+// include reads each file matching the glob pattern arg
+func (p *sshConfigParser) include(arg string, patterns []string, depth int) error {
+	fn, err := expandHome(arg)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(fn) {
+		fn = filepath.Join(p.dir, fn)
+	}
+	matches, err := filepath.Glob(fn)
+	if err != nil {
+		return fmt.Errorf("ssh config: include %s - %v", arg, err)
+	}
+	for _, m := range matches {
+		if err := p.readFile(m, patterns, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSSHConfigLine returns the lower case keyword and arguments of
+// a line.  Arguments may be enclosed in double quotes.
+func splitSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return "", nil, nil
+	}
+	idx := strings.IndexAny(line, " \t=")
+	if idx < 0 {
+		return "", nil, fmt.Errorf("keyword %s has no value", line)
+	}
+	keyword := strings.ToLower(line[:idx])
+	rest := strings.TrimLeft(line[idx:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+	var args []string
+	for rest != "" {
+		var arg string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return "", nil, errors.New("unterminated quote")
+			}
+			arg, rest = rest[1:end+1], rest[end+2:]
+		} else if rest[0] == '#' {
+			break
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			arg, rest = rest[:end], rest[end:]
+		}
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("keyword %s has no value", keyword)
+	}
+	return keyword, args, nil
+}
+
+// host resolves the values for alias.  A non-empty userID or port
+// takes precedence over the config values.
+func (p *sshConfigParser) host(alias, userID, port string) (*sshConfigHost, error) {
+	if alias == "" {
+		return nil, errors.New("ssh config: empty host alias")
+	}
+	h := &sshConfigHost{user: userID, port: port}
+	for _, l := range p.lines {
+		if !matchHostPatterns(l.patterns, alias) {
+			continue
+		}
+		var field *string
+		switch l.keyword {
+		case "hostname":
+			field = &h.hostName
+		case "port":
+			field = &h.port
+		case "user":
+			field = &h.user
+		case "identityfile":
+			field = &h.identityFile
+		case "proxyjump":
+			field = &h.proxyJump
+		case "userknownhostsfile":
+			// all files listed by the first line are used
+			if h.knownHostsFiles == nil {
+				h.knownHostsFiles = l.args
+			}
+			continue
+		default:
+			continue
+		}
+		if *field == "" {
+			*field = l.args[0]
+		}
+	}
+	if h.hostName == "" {
+		h.hostName = alias
+	}
+	h.hostName = p.expandTokens(h.hostName, h, alias)
+	if h.user == "" {
+		if u, err := user.Current(); err == nil {
+			h.user = u.Username
+		}
+	}
+	if h.identityFile == "none" {
+		h.identityFile = ""
+	}
+	h.identityFile = p.expandTokens(h.identityFile, h, h.hostName)
+	files := h.knownHostsFiles
+	switch {
+	case files == nil:
+		files = defaultKnownHostsFiles
+	case len(files) == 1 && files[0] == "none":
+		files = nil
+	}
+	h.knownHostsFiles = nil
+	for _, fn := range files {
+		h.knownHostsFiles = append(h.knownHostsFiles, p.expandTokens(fn, h, h.hostName))
+	}
+	return h, nil
+}
+
+// jumpHost resolves a ProxyJump entry in the form [user@]host[:port]
+func (p *sshConfigParser) jumpHost(jump string) (JumpHostConfig, error) {
+	userID, hostport := "", jump
+	if idx := strings.LastIndex(jump, "@"); idx >= 0 {
+		userID, hostport = jump[:idx], jump[idx+1:]
+	}
+	alias, port := hostport, ""
+	if host, prt, err := net.SplitHostPort(hostport); err == nil {
+		alias, port = host, prt
+	}
+	h, err := p.host(alias, userID, port)
+	if err != nil {
+		return JumpHostConfig{}, err
+	}
+	return JumpHostConfig{
+		HostPort:       h.hostPort(),
+		UserID:         h.user,
+		ClientKeyFile:  h.identityFile,
+		KnownHostsFile: h.knownHostsFile(),
+		UseAgent:       h.identityFile == "",
+	}, nil
+}
+
+// expandTokens replaces a leading "~/" and the %%, %d, %h, %p, %r and %u
+// tokens of s.  hostName is the value used for %h.
+func (p *sshConfigParser) expandTokens(s string, h *sshConfigHost, hostName string) string {
+	if strings.HasPrefix(s, "~/") {
+		s = filepath.Join(p.home, s[2:])
+	}
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	port := h.port
+	if port == "" {
+		port = "22"
+	}
+	return strings.NewReplacer("%%", "%", "%d", p.home, "%h", hostName,
+		"%p", port, "%r", h.user, "%u", localUser).Replace(s)
+}
+
+// matchHostPatterns reports whether host matches the Host patterns.  A
+// matching negated pattern excludes the host.
+func matchHostPatterns(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	matched := false
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "!") {
+			if matchPattern(pattern[1:], host) {
+				return false
+			}
+			continue
+		}
+		if matchPattern(pattern, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchPattern matches s against an OpenSSH pattern where '*' matches
+// zero or more characters and '?' matches exactly one character
+func matchPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
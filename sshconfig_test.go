@@ -0,0 +1,166 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jfcote87/sshdb"
+)
+
+func TestLoadSSHConfig(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Errorf("home dir %v", err)
+		return
+	}
+	fn := "testfiles/sshconfig/config"
+	sep := string(os.PathListSeparator)
+	defaultKnownHosts := filepath.Join(home, ".ssh/known_hosts") + sep + filepath.Join(home, ".ssh/known_hosts2")
+	bastion := sshdb.JumpHostConfig{
+		HostPort:      "bastion.example.com:2222",
+		UserID:        "jump",
+		ClientKeyFile: "testfiles/test_key",
+	}
+	gateway := sshdb.JumpHostConfig{
+		HostPort:       "gateway.example.com:2200",
+		UserID:         "admin",
+		ClientKeyFile:  filepath.Join(home, ".ssh/id_admin"),
+		KnownHostsFile: defaultKnownHosts,
+	}
+	tests := []struct {
+		alias string
+		want  *sshdb.TunnelConfig
+	}{
+		{alias: "db-primary", want: &sshdb.TunnelConfig{
+			HostPort:       "db-primary.internal:22",
+			UserID:         "pgadmin",
+			ClientKeyFile:  "testfiles/test_key",
+			KnownHostsFile: "testfiles/sshconfig/known_hosts",
+			JumpHosts:      []sshdb.JumpHostConfig{bastion, gateway},
+		}},
+		{alias: "DB-LEGACY", want: &sshdb.TunnelConfig{
+			HostPort:       "DB-LEGACY:22",
+			UserID:         "dbuser",
+			ClientKeyFile:  filepath.Join(home, ".ssh/id_dbuser"),
+			KnownHostsFile: "testfiles/sshconfig/known_hosts",
+		}},
+		{alias: "db-bastion", want: &sshdb.TunnelConfig{
+			HostPort:      "bastion.example.com:2222",
+			UserID:        "jump",
+			ClientKeyFile: "testfiles/test_key",
+		}},
+		{alias: "prod db", want: &sshdb.TunnelConfig{
+			HostPort:       "prod.internal:22",
+			UserID:         "dbuser",
+			ClientKeyFile:  filepath.Join(home, ".ssh/id_dbuser"),
+			KnownHostsFile: "testfiles/sshconfig/known_hosts" + sep + filepath.Join(home, ".ssh/known_hosts_prod.internal"),
+		}},
+		{alias: "other.example.com", want: &sshdb.TunnelConfig{
+			HostPort:       "other.example.com:22",
+			UserID:         "dbuser",
+			ClientKeyFile:  filepath.Join(home, ".ssh/id_dbuser"),
+			KnownHostsFile: defaultKnownHosts,
+		}},
+	}
+	for _, tt := range tests {
+		got, err := sshdb.LoadSSHConfig(fn, tt.alias)
+		if err != nil {
+			t.Errorf("%s LoadSSHConfig %v", tt.alias, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s expected %#v; got %#v", tt.alias, tt.want, got)
+		}
+	}
+	if _, err := sshdb.LoadSSHConfig("testfiles/sshconfig/doesnotexist", "db-primary"); err == nil {
+		t.Errorf("expected missing file error")
+	}
+}
+
+func TestTunnelConfig_SSHConfigHost(t *testing.T) {
+	sshdb.RegisterDriver("test_driver", testDriver)
+	cfg := &sshdb.TunnelConfig{
+		SSHConfigFile: "testfiles/sshconfig/config",
+		SSHConfigHost: "db-primary",
+		UserID:        "explicit_user",
+		JumpHosts: []sshdb.JumpHostConfig{
+			{HostPort: "jump.example.com:22", UserID: "me", Pwd: "jumppwd"},
+		},
+		Datasources: map[string]sshdb.Datasource{
+			"valid": {DriverName: "test_driver", ConnectionString: "valid_dsn_string"},
+		},
+		KnownHostsFile: "testfiles/sshconfig/known_hosts",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate %v", err)
+	}
+	if _, err := cfg.DatabaseMap(); err != nil {
+		t.Errorf("DatabaseMap %v", err)
+		return
+	}
+	defer cfg.Close()
+	tun, err := cfg.Tunnel()
+	if err != nil {
+		t.Errorf("Tunnel %v", err)
+		return
+	}
+	if addr := sshdb.TunnelAddr(tun); addr != "db-primary.internal:22" {
+		t.Errorf("expected tunnel address db-primary.internal:22; got %s", addr)
+	}
+	// ssh config values must not be written to the config
+	if cfg.HostPort != "" || cfg.UserID != "explicit_user" || cfg.ClientKeyFile != "" ||
+		len(cfg.JumpHosts) != 1 || cfg.JumpHosts[0].HostPort != "jump.example.com:22" {
+		t.Errorf("expected config to be unchanged; got %#v", cfg)
+	}
+
+	// Reopen rereads the ssh config file
+	fn := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(fn, []byte("Host db\n    HostName first.internal\n"), 0600); err != nil {
+		t.Errorf("write ssh config %v", err)
+		return
+	}
+	cfg.SSHConfigFile, cfg.SSHConfigHost = fn, "db"
+	if err := cfg.Reopen(); err != nil {
+		t.Errorf("Reopen %v", err)
+		return
+	}
+	if err := os.WriteFile(fn, []byte("Host db\n    HostName second.internal\n    Port 2222\n"), 0600); err != nil {
+		t.Errorf("write ssh config %v", err)
+		return
+	}
+	if err := cfg.Reopen(); err != nil {
+		t.Errorf("Reopen %v", err)
+		return
+	}
+	if tun, err = cfg.Tunnel(); err != nil || sshdb.TunnelAddr(tun) != "second.internal:2222" {
+		t.Errorf("expected tunnel address second.internal:2222 after Reopen; got %v", err)
+	}
+	// the ssh config file is not read once the tunnel is created
+	if err := os.Remove(fn); err != nil {
+		t.Errorf("remove ssh config %v", err)
+		return
+	}
+	if cached, err := cfg.Tunnel(); err != nil || cached != tun {
+		t.Errorf("expected cached tunnel; got %v", err)
+	}
+
+	cfg = &sshdb.TunnelConfig{
+		SSHConfigFile: "testfiles/sshconfig/doesnotexist",
+		SSHConfigHost: "db-primary",
+		Datasources: map[string]sshdb.Datasource{
+			"valid": {DriverName: "test_driver", ConnectionString: "valid_dsn_string"},
+		},
+	}
+	var ce *sshdb.ConfigError
+	if _, err := cfg.DatabaseMap(); !errors.As(err, &ce) || ce.Idx != 34 {
+		t.Errorf("expected ConfigError 34; got %v", err)
+	}
+}
@@ -25,7 +25,8 @@ import (
 // defines a connection from the remote server to the desired
 // database.
 //
-// This package includes drivers for mysql, mssql, postgress (v3 and v4).
+// This package includes drivers for mysql, mssql (including azuread), clickhouse and postgress (pgx v3, v4 and v5
+// and lib/pq).
 type Driver interface {
 	OpenConnector(dialer Dialer, dsn string) (driver.Connector, error)
 	Name() string
@@ -50,6 +51,24 @@ func (d DialerFunc) DialContext(ctx context.Context, net, addr string) (net.Conn
 // the form "host:port", "host%zone:port", [host]:port" or "[host%zone]:port".  See func net.Dial
 // for a more detailed description of the hostport format.
 func New(clientConfig *ssh.ClientConfig, remoteHostPort string) (*Tunnel, error) {
+	return NewWithJumpHosts(clientConfig, remoteHostPort)
+}
+
+// JumpHost describes an intermediate ssh server used to reach the
+// tunnel's remote host, equivalent to an entry in OpenSSH's ProxyJump.
+type JumpHost struct {
+	// ClientConfig authenticates the connection to the jump host
+	ClientConfig *ssh.ClientConfig
+	// HostPort is the address of the jump host as seen from the prior
+	// hop (or from the local machine for the first jump host).
+	HostPort string
+}
+
+// NewWithJumpHosts returns a Tunnel whose ssh client connection is established through
+// the ordered chain of jumpHosts.  The first jump host is dialed directly and each
+// subsequent host, including the final remoteHostPort, is dialed via the prior hop's
+// client.  A reset anywhere in the chain closes and later rebuilds the entire path.
+func NewWithJumpHosts(clientConfig *ssh.ClientConfig, remoteHostPort string, jumpHosts ...JumpHost) (*Tunnel, error) {
 	if clientConfig == nil {
 		return nil, errors.New("clientConfig may not be nil")
 	}
@@ -59,6 +78,14 @@ func New(clientConfig *ssh.ClientConfig, remoteHostPort string) (*Tunnel, error)
 	if _, _, err := net.SplitHostPort(remoteHostPort); err != nil {
 		return nil, fmt.Errorf("invalid address - %w", err)
 	}
+	for i, jh := range jumpHosts {
+		if jh.ClientConfig == nil {
+			return nil, fmt.Errorf("jump host [%d] clientConfig may not be nil", i)
+		}
+		if _, _, err := net.SplitHostPort(jh.HostPort); err != nil {
+			return nil, fmt.Errorf("jump host [%d] invalid address - %w", i, err)
+		}
+	}
 
 	resetChan := make(chan struct{})
 	close(resetChan) // close to prevent reset calls prior to client initialization
@@ -66,6 +93,7 @@ func New(clientConfig *ssh.ClientConfig, remoteHostPort string) (*Tunnel, error)
 	return &Tunnel{
 		cfg:        clientConfig,
 		addr:       remoteHostPort,
+		jumpHosts:  jumpHosts,
 		connectors: make(map[string]driver.Connector),
 		sshconns:   make(map[*sshConn]bool),
 		resetChan:  resetChan,
@@ -77,26 +105,68 @@ func New(clientConfig *ssh.ClientConfig, remoteHostPort string) (*Tunnel, error)
 type Tunnel struct {
 	cfg                      *ssh.ClientConfig
 	addr                     string                      // format <hostname>:<port>
+	jumpHosts                []JumpHost                  // intermediate hosts dialed in order
 	connectors               map[string]driver.Connector // map of dsn to connector
 	ignoreSetDeadlineRequest bool
-	mConn                    sync.Mutex // protects connectors and ignoreDeadlineError
+	keepaliveInterval        time.Duration // disabled when <= 0
+	keepaliveMaxMissed       int
+	underlay                 Dialer     // dials the first ssh host; net.Dialer when nil
+	mConn                    sync.Mutex // protects connectors, ignoreDeadlineError, keepalive settings and underlay
 
-	sshconns  map[*sshConn]bool // initialized on dialcontext
-	client    *ssh.Client
-	resetChan chan struct{} // closed at reset
-	m         sync.Mutex    //protects sshconns, client and resetChan
+	sshconns        map[*sshConn]bool // initialized on dialcontext
+	client          *ssh.Client
+	jumpClients     []*ssh.Client            // clients for each jump host in dial order
+	hs              *handshake               // in progress client connection
+	listeners       map[*remoteListener]bool // open remote listeners
+	stopped         bool                     // set by stop to prevent new client connections
+	resetChan       chan struct{}            // closed at reset
+	maxChannels     int                      // limit of sshconns plus pendingChannels; unlimited when <= 0
+	pendingChannels int                      // channels reserved by getNetConn but not yet added to sshconns
+	channelWait     chan struct{}            // closed when a channel is released
+	m               sync.Mutex               //protects sshconns, client, jumpClients, hs, listeners, stopped, resetChan and channel limits
 }
 
 // IgnoreSetDeadlineRequest exists because the ssh client package does not support
-// deadlines and returns an error if attempting to set a deadline.  If existing
-// code contains setdeadline calls, pass true to this functions, and the tunnel
-// ignore deadline requests.
+// deadlines.  Tunnel connections now emulate deadlines, so this is rarely needed.
+// Pass true to this function, and the tunnel ignores deadline requests.
 func (tun *Tunnel) IgnoreSetDeadlineRequest(val bool) {
 	tun.mConn.Lock()
 	tun.ignoreSetDeadlineRequest = val
 	tun.mConn.Unlock()
 }
 
+// DefaultKeepaliveMaxMissed is the number of consecutive unanswered keepalive
+// requests allowed before the tunnel is reset when SetKeepalive is passed a
+// maxMissed value less than 1.
+const DefaultKeepaliveMaxMissed = 3
+
+const keepaliveRequest = "keepalive@openssh.com"
+
+// SetKeepalive enables a keepalive loop on each new ssh client connection.  Every
+// interval a keepalive@openssh.com request is sent to the server.  A request that fails
+// or receives no reply within interval is counted as missed, and the tunnel is reset
+// after maxMissed consecutive misses. An interval <= 0 disables keepalives.  Changes
+// take effect on the next client connection.
+func (tun *Tunnel) SetKeepalive(interval time.Duration, maxMissed int) {
+	if maxMissed < 1 {
+		maxMissed = DefaultKeepaliveMaxMissed
+	}
+	tun.mConn.Lock()
+	tun.keepaliveInterval = interval
+	tun.keepaliveMaxMissed = maxMissed
+	tun.mConn.Unlock()
+}
+
+// SetUnderlayDialer sets the Dialer used to create the connection to the first ssh
+// host, either the first jump host or the remote host.  Use NewProxyDialer to reach
+// the ssh server via an http or socks5 proxy.  Passing nil restores the default
+// net.Dialer.  Changes take effect on the next client connection.
+func (tun *Tunnel) SetUnderlayDialer(d Dialer) {
+	tun.mConn.Lock()
+	tun.underlay = d
+	tun.mConn.Unlock()
+}
+
 // OpenConnector fulfills the driver DriverContext interface and returns a new
 // db connection via the ssh client connection.  The dataSourceName should follow
 // rules of the base database and must create the connection as if connecting from
@@ -125,52 +195,335 @@ func (tun *Tunnel) Close() error {
 	return err
 }
 
+// errTunnelStopped is returned when a tunnel discarded by its
+// TunnelConfig is used
+var errTunnelStopped = errors.New("sshdb: tunnel closed by its TunnelConfig")
+
+// stop closes the remote listeners and client of a tunnel discarded by a
+// TunnelConfig and abandons any handshake in progress.  Afterwards no client
+// connection is made, so Forwarders and listeners created from the tunnel
+// fail rather than reconnecting.
+func (tun *Tunnel) stop() error {
+	tun.m.Lock()
+	tun.stopped = true
+	if hs := tun.hs; hs != nil {
+		// abandon handshake so its client is not installed
+		tun.hs = nil
+		hs.cancel()
+	}
+	listeners := make([]*remoteListener, 0, len(tun.listeners))
+	for rl := range tun.listeners {
+		listeners = append(listeners, rl)
+	}
+	err := tun.reset()
+	tun.m.Unlock()
+	for _, rl := range listeners {
+		rl.Close()
+	}
+	return err
+}
+
 // DialContext creates an ssh client connection to the addr.  sshdb drivers must use this
 // func when creating driver.Connectors.  You may use this func to establish "raw" connections
-// to a remote service.
+// to a remote service.  If the tunnel has no client connection, one is established using
+// ctx to bound the tcp dial and ssh handshake. Concurrent callers share a single handshake.
 func (tun *Tunnel) DialContext(ctx context.Context, _, addr string) (net.Conn, error) {
-	// lock sd for the duration
-	tun.m.Lock()
-	defer tun.m.Unlock()
-
-	ctxchan := ctx.Done()
-	select {
-	// check for timeout or cancel of ctx
-	case <-ctxchan:
-		return nil, ctx.Err()
-
-	// if tunnel is not open create new tunnel
-	case <-tun.resetChan:
-		// create tunnel ssh client connection
-		cl, err := ssh.Dial("tcp", tun.addr, tun.cfg)
+	for {
+		cl, resetChan, err := tun.getClient(ctx)
 		if err != nil {
 			return nil, err
 		}
+		conn, err := tun.getNetConn(ctx, cl, resetChan, addr)
+		if err != errClientReset {
+			return conn, err
+		}
+	}
+}
+
+// errClientReset signals that the client was reset while opening a channel
+var errClientReset = errors.New("sshdb: client reset during dial")
+
+// handshake tracks a client connection in progress.  Callers of
+// getClient wait on a single handshake rather than starting their own.
+type handshake struct {
+	done    chan struct{} // closed when handshake completes
+	err     error
+	waiters int    // number of callers waiting on done
+	cancel  func() // aborts the handshake when no callers remain
+}
+
+// getClient returns the tunnel's current client along with its reset
+// channel, starting or joining a handshake if no client is connected.
+func (tun *Tunnel) getClient(ctx context.Context) (*ssh.Client, <-chan struct{}, error) {
+	for {
+		tun.m.Lock()
+		// check for timeout or cancel of ctx
+		if err := ctx.Err(); err != nil {
+			tun.m.Unlock()
+			return nil, nil, err
+		}
+		if tun.stopped {
+			tun.m.Unlock()
+			return nil, nil, errTunnelStopped
+		}
 		select {
-		case <-ctxchan:
-			cl.Close() // if context cancelled, close new client connection
-			return nil, ctx.Err()
+		case <-tun.resetChan: // no client so wait for handshake
 		default:
+			cl, resetChan := tun.client, tun.resetChan
+			tun.m.Unlock()
+			return cl, resetChan, nil
+		}
+		hs := tun.hs
+		if hs == nil {
+			hs = tun.startHandshake()
+		}
+		hs.waiters++
+		tun.m.Unlock()
+
+		select {
+		case <-hs.done:
+		case <-ctx.Done():
+		}
+		tun.m.Lock()
+		if hs.waiters--; hs.waiters == 0 && tun.hs == hs {
+			select {
+			case <-hs.done:
+			default:
+				// last caller has quit so abandon handshake
+				tun.hs = nil
+				hs.cancel()
+			}
+		}
+		tun.m.Unlock()
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if hs.err != nil {
+			return nil, nil, hs.err
+		}
+	}
+}
+
+// startHandshake begins a new client connection in a separate go routine.
+// Routines must obtain a lock on tunnel.m prior to calling.
+func (tun *Tunnel) startHandshake() *handshake {
+	ctx, cancel := context.WithCancel(context.Background())
+	hs := &handshake{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	tun.hs = hs
+	go func() {
+		defer cancel()
+		// create tunnel ssh client connection
+		cl, jumpClients, err := tun.dialClient(ctx)
+		tun.m.Lock()
+		defer tun.m.Unlock()
+		defer close(hs.done)
+		if tun.hs != hs || tun.stopped {
+			// handshake abandoned by all callers or tunnel stopped
+			if err == nil {
+				closeClients(cl, jumpClients)
+				err = context.Canceled
+			}
+			if tun.stopped {
+				err = errTunnelStopped
+			}
+			hs.err = err
+			return
+		}
+		tun.hs = nil
+		if err != nil {
+			hs.err = err
+			return
 		}
 		tun.client = cl
+		tun.jumpClients = jumpClients
 		clientResetChannel := make(chan struct{})
 		tun.resetChan = clientResetChannel
 		go func() {
 			// if client connection close (network error)
 			// reset channel to close all db connections
 			_ = cl.Wait()
-			select {
-			case <-clientResetChannel:
-				return
-			default:
-				tun.Close()
-			}
+			tun.resetClient(clientResetChannel)
 		}()
+		tun.mConn.Lock()
+		interval, maxMissed := tun.keepaliveInterval, tun.keepaliveMaxMissed
+		tun.mConn.Unlock()
+		if interval > 0 {
+			go tun.keepalive(cl, clientResetChannel, interval, maxMissed)
+		}
+	}()
+	return hs
+}
+
+// resetClient resets the tunnel unless the client associated with
+// resetChan has already been reset.
+func (tun *Tunnel) resetClient(resetChan <-chan struct{}) {
+	tun.m.Lock()
+	select {
+	case <-resetChan: // already reset
+	default:
+		tun.reset()
+	}
+	tun.m.Unlock()
+}
+
+// keepalive sends keepalive requests on the client until done is closed
+// and resets the tunnel when maxMissed consecutive requests go unanswered.
+func (tun *Tunnel) keepalive(cl *ssh.Client, done <-chan struct{}, interval time.Duration, maxMissed int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if sendKeepalive(cl, interval) {
+			missed = 0
+			continue
+		}
+		if missed++; missed >= maxMissed {
+			tun.resetClient(done)
+			return
+		}
+	}
+}
+
+// sendKeepalive returns true if the server replies to a keepalive request
+// within the timeout.  Any reply, including a failure, means the server is alive.
+func sendKeepalive(cl *ssh.Client, timeout time.Duration) bool {
+	errc := make(chan error, 1)
+	go func() {
+		// a blocked request is released when the client is closed
+		_, _, err := cl.SendRequest(keepaliveRequest, true, nil)
+		errc <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-errc:
+		return err == nil
+	case <-timer.C:
+	}
+	return false
+}
+
+// dialClient connects to the remote host through each jump host and
+// returns the final client along with the jump host clients.
+func (tun *Tunnel) dialClient(ctx context.Context) (*ssh.Client, []*ssh.Client, error) {
+	hops := make([]JumpHost, 0, len(tun.jumpHosts)+1)
+	hops = append(append(hops, tun.jumpHosts...), JumpHost{ClientConfig: tun.cfg, HostPort: tun.addr})
+	tun.mConn.Lock()
+	underlay := tun.underlay
+	tun.mConn.Unlock()
+	var clients []*ssh.Client
+	var cl *ssh.Client
+	for i, h := range hops {
+		var err error
+		if cl, err = hop(ctx, underlay, cl, h.HostPort, h.ClientConfig); err != nil {
+			closeClients(nil, clients)
+			if i < len(tun.jumpHosts) {
+				return nil, nil, fmt.Errorf("jump host %s - %w", h.HostPort, err)
+			}
+			return nil, nil, err
+		}
+		clients = append(clients, cl)
+	}
+	return cl, clients[:len(clients)-1], nil
+}
 
+// hop creates a new ssh client connection to addr.  If prior is nil, a tcp
+// connection is dialed using underlay (or a net.Dialer when nil); otherwise a
+// channel of the prior client is used as the underlying connection.
+func hop(ctx context.Context, underlay Dialer, prior *ssh.Client, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	var conn net.Conn
+	var err error
+	switch {
+	case prior == nil && underlay == nil:
+		d := net.Dialer{Timeout: cfg.Timeout}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	case prior == nil:
+		dctx, cancel := ctx, func() {}
+		if cfg.Timeout > 0 {
+			dctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		}
+		conn, err = underlay.DialContext(dctx, "tcp", addr)
+		cancel()
 	default:
+		conn, err = dialWithContext(ctx, func() (net.Conn, error) {
+			return prior.Dial("tcp", addr)
+		})
+	}
+	if err != nil {
+		return nil, err
 	}
-	// make connection
-	return tun.getNetConn(addr)
+	// close conn to interrupt the handshake if ctx ends
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	close(stop)
+	<-stopped
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if err == nil {
+			c.Close()
+		}
+		return nil, ctxErr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialWithContext runs dial and returns when either dial completes or
+// ctx ends.  A connection returned after ctx ends is closed.
+func dialWithContext(ctx context.Context, dial func() (net.Conn, error)) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := dial()
+		ch <- result{conn, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.conn, r.err
+	case <-ctx.Done():
+	}
+	go func() {
+		if r := <-ch; r.conn != nil {
+			r.conn.Close()
+		}
+	}()
+	return nil, ctx.Err()
+}
+
+// closeClients closes the client and then each jump client
+// in reverse dial order.  Returns the first error encountered.
+func closeClients(cl *ssh.Client, jumpClients []*ssh.Client) error {
+	var err error
+	if cl != nil {
+		err = cl.Close()
+	}
+	for i := len(jumpClients) - 1; i >= 0; i-- {
+		if cerr := jumpClients[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
 // reset closes the tunnel's client connection and closes
@@ -189,27 +542,99 @@ func (tun *Tunnel) reset() error {
 			k.Conn.Close()
 		}
 		tun.sshconns = make(map[*sshConn]bool)
-		if tun.client != nil {
-			return tun.client.Close()
+		tun.releaseChannel()
+		cl, jumpClients := tun.client, tun.jumpClients
+		tun.jumpClients = nil
+		if cl != nil {
+			return closeClients(cl, jumpClients)
 		}
 	}
 	return nil
 }
 
-// getNetConn create a client connection through the tunnel
-func (tun *Tunnel) getNetConn(addr string) (net.Conn, error) {
-	network := "tcp"
-	if len(addr) > 0 && addr[0] == '/' {
-		network = "unix"
+// SetMaxChannels limits the number of concurrent connections opened through the
+// tunnel.  Each connection is an ssh channel, and servers may limit the channels
+// allowed per client (e.g. the OpenSSH MaxSessions setting).  When the limit is
+// reached, DialContext waits until a connection closes or its context is done.
+// Connections accepted by a remote listener count toward the limit but are not
+// refused.  A value <= 0 removes the limit.
+func (tun *Tunnel) SetMaxChannels(n int) {
+	tun.m.Lock()
+	tun.maxChannels = n
+	tun.releaseChannel()
+	tun.m.Unlock()
+}
+
+// reserveChannel waits until the number of open and pending channels is
+// below maxChannels and then increments pendingChannels.
+func (tun *Tunnel) reserveChannel(ctx context.Context) error {
+	tun.m.Lock()
+	for tun.maxChannels > 0 && len(tun.sshconns)+tun.pendingChannels >= tun.maxChannels {
+		if tun.channelWait == nil {
+			tun.channelWait = make(chan struct{})
+		}
+		wait := tun.channelWait
+		tun.m.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wait:
+		}
+		tun.m.Lock()
+	}
+	tun.pendingChannels++
+	tun.m.Unlock()
+	return nil
+}
+
+// releaseChannel wakes routines waiting in reserveChannel.  Routines must
+// obtain a lock on tun.m prior to calling.
+func (tun *Tunnel) releaseChannel() {
+	if tun.channelWait != nil {
+		close(tun.channelWait)
+		tun.channelWait = nil
+	}
+}
+
+// getNetConn create a client connection through the tunnel.  The
+// channel is opened without holding tunnel.m, so errClientReset is
+// returned if the client was reset in the meantime.
+func (tun *Tunnel) getNetConn(ctx context.Context, cl *ssh.Client, resetChan <-chan struct{}, addr string) (net.Conn, error) {
+	if err := tun.reserveChannel(ctx); err != nil {
+		return nil, err
 	}
-	conn, err := tun.client.Dial(network, addr)
+	conn, err := dialWithContext(ctx, func() (net.Conn, error) {
+		return cl.Dial(network(addr), addr)
+	})
 	if err != nil {
+		tun.m.Lock()
+		tun.pendingChannels--
+		tun.releaseChannel()
+		tun.m.Unlock()
+		if isClosedChan(resetChan) {
+			return nil, errClientReset
+		}
 		return nil, err
 	}
-	sshconn := &sshConn{
-		tunnel: tun,
-		Conn:   conn,
+	return tun.addConn(conn, resetChan, true)
+}
+
+// addConn wraps conn as an sshConn tracked by the tunnel.  reserved reports
+// whether conn was opened after a reserveChannel call.  If the client
+// associated with resetChan has been reset, conn is closed and errClientReset
+// is returned.
+func (tun *Tunnel) addConn(conn net.Conn, resetChan <-chan struct{}, reserved bool) (net.Conn, error) {
+	tun.m.Lock()
+	defer tun.m.Unlock()
+	if reserved {
+		tun.pendingChannels--
+	}
+	if isClosedChan(resetChan) {
+		tun.releaseChannel()
+		conn.Close()
+		return nil, errClientReset
 	}
+	sshconn := newSSHConn(tun, conn)
 	tun.sshconns[sshconn] = true
 	return sshconn, nil
 }
@@ -225,52 +650,94 @@ func (tun *Tunnel) ConnCount() int {
 
 // handleDeadline uses the ignoreDeadlineError to determine whether to
 // handle a setdeadline call on a sshConn
-func (tun *Tunnel) handleDeadline(tm time.Time, setDeadline func(time.Time) error) error {
-	var err error
+func (tun *Tunnel) handleDeadline(tm time.Time, setDeadline ...func(time.Time)) error {
 	tun.mConn.Lock()
-	if !tun.ignoreSetDeadlineRequest {
-		err = setDeadline(tm)
-	}
+	ignore := tun.ignoreSetDeadlineRequest
 	tun.mConn.Unlock()
-	return err
+	if !ignore {
+		for _, f := range setDeadline {
+			f(tm)
+		}
+	}
+	return nil
 }
 
 type sshConn struct {
 	tunnel *Tunnel
 	net.Conn
+
+	readDeadline  *connDeadline
+	writeDeadline *connDeadline
+	mRead         sync.Mutex // serializes reads and protects reader
+	reader        asyncIO
+	mWrite        sync.Mutex // serializes writes and protects writer
+	writer        asyncIO
 }
 
-// Close resets tunnel if last connection other wise
+func newSSHConn(tun *Tunnel, conn net.Conn) *sshConn {
+	return &sshConn{
+		tunnel:        tun,
+		Conn:          conn,
+		readDeadline:  newConnDeadline(),
+		writeDeadline: newConnDeadline(),
+	}
+}
+
+// Close resets tunnel if last connection and no remote listeners are open other wise
 // closes connection and updates tunnel ssh connections
 // map.
 func (sc *sshConn) Close() error {
 	tunnel := sc.tunnel
 	tunnel.m.Lock()
 	defer tunnel.m.Unlock()
-	if len(tunnel.sshconns) > 1 {
+	if !tunnel.sshconns[sc] {
+		// connection closed by a prior reset
+		return sc.Conn.Close()
+	}
+	if len(tunnel.sshconns) > 1 || len(tunnel.listeners) > 0 {
 		delete(tunnel.sshconns, sc)
+		tunnel.releaseChannel()
 		return sc.Conn.Close()
 	}
 	return tunnel.reset()
 }
 
-// SetDeadline is not implemented by the ssh tcp connection.  If
-// the tunnel Driver implements ingnoreDeadlineError then a nil is
-// returned rather than a not implemented error.
+// Read reads data from the ssh channel.  A pending Read returns a
+// timeout error when the read deadline passes without closing the channel.
+func (sc *sshConn) Read(b []byte) (int, error) {
+	sc.mRead.Lock()
+	defer sc.mRead.Unlock()
+	return sc.read(b)
+}
+
+// Write writes data to the ssh channel. A pending Write returns a
+// timeout error when the write deadline passes without closing the channel.
+// The data of a timed out Write may still be sent; the next Write waits for
+// it to complete.
+func (sc *sshConn) Write(b []byte) (int, error) {
+	sc.mWrite.Lock()
+	defer sc.mWrite.Unlock()
+	return sc.write(b)
+}
+
+// SetDeadline sets the read and write deadlines.  The ssh channel does not
+// support deadlines so they are emulated by the sshConn.  A deadline set from
+// another goroutine interrupts a pending Read.  If the tunnel has been set to
+// ignore deadline requests, the deadline is not set.
 func (sc *sshConn) SetDeadline(tm time.Time) error {
-	return sc.tunnel.handleDeadline(tm, sc.Conn.SetDeadline)
+	return sc.tunnel.handleDeadline(tm, sc.readDeadline.set, sc.writeDeadline.set)
 }
 
-// SetReadDeadline is not implemented by the ssh tcp connection.  If
-// the tunnel Driver implements ingnoreDeadlineError then a nil is
-// returned rather than a not implemented error.
+// SetReadDeadline sets the deadline for pending and future Read calls.
+// If the tunnel has been set to ignore deadline requests, the deadline
+// is not set.
 func (sc *sshConn) SetReadDeadline(tm time.Time) error {
-	return sc.tunnel.handleDeadline(tm, sc.Conn.SetReadDeadline)
+	return sc.tunnel.handleDeadline(tm, sc.readDeadline.set)
 }
 
-// SetDeadline is not implemented by the ssh tcp connection.  If
-// the tunnel Driver implements ingnoreDeadlineError then a nil is
-// returned rather than a not implemented error.
+// SetWriteDeadline sets the deadline for pending and future Write calls.
+// If the tunnel has been set to ignore deadline requests, the deadline
+// is not set.
 func (sc *sshConn) SetWriteDeadline(tm time.Time) error {
-	return sc.tunnel.handleDeadline(tm, sc.Conn.SetWriteDeadline)
+	return sc.tunnel.handleDeadline(tm, sc.writeDeadline.set)
 }
@@ -7,10 +7,18 @@ package sshdb
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // TestDialContext checks that tun.DialContext handles context
@@ -28,6 +36,55 @@ func TestDialContext(t *testing.T) {
 	}
 }
 
+// TestTunnel_StopDuringHandshake checks that stop abandons a handshake
+// in progress
+func TestTunnel_StopDuringHandshake(t *testing.T) {
+	// server accepts tcp connections but never responds to the ssh handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Errorf("listen failed %v", err)
+		return
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	tun, err := New(&ssh.ClientConfig{User: "me", HostKeyCallback: ssh.InsecureIgnoreHostKey()}, l.Addr().String())
+	if err != nil {
+		t.Errorf("new tunnel failed %v", err)
+		return
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := tun.DialContext(context.Background(), "tcp", "localhost:3306")
+		errChan <- err
+	}()
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Errorf("handshake not started")
+		return
+	}
+	_ = tun.stop()
+	select {
+	case err := <-errChan:
+		if err != errTunnelStopped {
+			t.Errorf("expected errTunnelStopped; got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("stop did not abandon handshake")
+	}
+	tun.m.Lock()
+	if tun.hs != nil || !isClosedChan(tun.resetChan) {
+		t.Errorf("expected no handshake or client after stop")
+	}
+	tun.m.Unlock()
+}
+
 type ConnectionCounter interface {
 	ConnCount() int
 }
@@ -71,3 +128,39 @@ func CloseClient(tun *Tunnel) error {
 	return errors.New("timeout")
 
 }
+
+// ForwarderTunnel returns the tunnel used by a Forwarder
+func ForwarderTunnel(f *Forwarder) *Tunnel {
+	return f.tun
+}
+
+// TunnelAddr returns the ssh server address of a Tunnel
+func TunnelAddr(tun *Tunnel) string {
+	return tun.addr
+}
+
+func TestKnownHostKeyAlgorithms(t *testing.T) {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Errorf("generate key %v", err)
+		return
+	}
+	signer, err := ssh.NewSignerFromKey(pk)
+	if err != nil {
+		t.Errorf("new signer %v", err)
+		return
+	}
+	fn := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("db.example.com:2222")}, signer.PublicKey())
+	if err := ioutil.WriteFile(fn, []byte(line+"\n"), 0600); err != nil {
+		t.Errorf("write known_hosts %v", err)
+		return
+	}
+	algos := knownHostKeyAlgorithms(fn, "db.example.com:2222")
+	if len(algos) != len(defaultHostKeyAlgos) || algos[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("expected %s first of %d algorithms; got %v", ssh.KeyAlgoED25519, len(defaultHostKeyAlgos), algos)
+	}
+	if algos := knownHostKeyAlgorithms(fn, "db.example.com:22"); algos != nil {
+		t.Errorf("expected nil algorithms for unknown host; got %v", algos)
+	}
+}
@@ -10,10 +10,15 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"os"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/jfcote87/sshdb"
 	"golang.org/x/crypto/ssh"
@@ -354,6 +359,199 @@ func TestTunnel_Fail(t *testing.T) {
 	db01.Close()
 }
 
+func TestTunnel_JumpHosts(t *testing.T) {
+	signer, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	remoteDbAddr := []string{"localhost:9234"}
+	bastion := &directTCPServer{
+		signer: serverSigner,
+		key:    signer.PublicKey(),
+		userID: "me",
+		addr:   "127.0.0.1:9232",
+		srvcfg: getPublicKeyServerCfg("me", signer.PublicKey()),
+	}
+	target := &directTCPServer{
+		signer: serverSigner,
+		key:    signer.PublicKey(),
+		userID: "me",
+		addr:   "127.0.0.1:9233",
+		laddr:  remoteDbAddr,
+		srvcfg: getPublicKeyServerCfg("me", signer.PublicKey()),
+	}
+	for _, ds := range []*directTCPServer{bastion, target} {
+		srvCloseFunc, err := ds.start()
+		if err != nil {
+			t.Errorf("directTCPServer start %v", err)
+			return
+		}
+		defer srvCloseFunc()
+	}
+
+	if _, err := sshdb.NewWithJumpHosts(target.clientConfig(), target.addr, sshdb.JumpHost{HostPort: bastion.addr}); err == nil {
+		t.Errorf("expected nil jump host clientConfig error")
+	}
+	// the bastion is used twice to test a multi-hop chain
+	tunnel, err := sshdb.NewWithJumpHosts(target.clientConfig(), target.addr,
+		sshdb.JumpHost{ClientConfig: bastion.clientConfig(), HostPort: bastion.addr},
+		sshdb.JumpHost{ClientConfig: bastion.clientConfig(), HostPort: bastion.addr})
+	if err != nil {
+		t.Errorf("new tunnel failed %v", err)
+		return
+	}
+	defer tunnel.Close()
+
+	connector, err := tunnel.OpenConnector(testDriver, remoteDbAddr[0])
+	if err != nil {
+		t.Errorf("unable to open connector %v", err)
+		return
+	}
+	// closing the db closes the last connection which resets the entire
+	// chain, so the second pass verifies that the path is rebuilt
+	for i := 0; i < 2; i++ {
+		db := sql.OpenDB(connector)
+		if err := db.Ping(); err != nil {
+			t.Errorf("ping %d failed %v", i, err)
+			db.Close()
+			return
+		}
+		if err := connectionCountTest(tunnel, 1); err != nil {
+			t.Errorf("%v", err)
+		}
+		db.Close()
+		if err := connectionCountTest(tunnel, 0); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+}
+
+func TestTunnel_Keepalive(t *testing.T) {
+	signer, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	tests := []struct {
+		name           string
+		addr           string
+		dbAddr         string
+		ignoreRequests bool
+		expectedCnt    int
+	}{
+		{name: "alive", addr: "127.0.0.1:9235", dbAddr: "localhost:9236", expectedCnt: 1},
+		{name: "dead", addr: "127.0.0.1:9237", dbAddr: "localhost:9238", ignoreRequests: true, expectedCnt: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := &directTCPServer{
+				signer:         serverSigner,
+				key:            signer.PublicKey(),
+				userID:         "me",
+				addr:           tt.addr,
+				laddr:          []string{tt.dbAddr},
+				srvcfg:         getPublicKeyServerCfg("me", signer.PublicKey()),
+				ignoreRequests: tt.ignoreRequests,
+			}
+			srvCloseFunc, err := ds.start()
+			if err != nil {
+				t.Errorf("directTCPServer start %v", err)
+				return
+			}
+			defer srvCloseFunc()
+			tunnel, err := sshdb.New(ds.clientConfig(), ds.addr)
+			if err != nil {
+				t.Errorf("new tunnel failed %v", err)
+				return
+			}
+			defer tunnel.Close()
+			tunnel.SetKeepalive(20*time.Millisecond, 2)
+
+			conn, err := tunnel.DialContext(context.Background(), "tcp", tt.dbAddr)
+			if err != nil {
+				t.Errorf("dial failed %v", err)
+				return
+			}
+			defer conn.Close()
+			time.Sleep(200 * time.Millisecond)
+			if err := connectionCountTest(tunnel, tt.expectedCnt); err != nil {
+				t.Errorf("%v", err)
+			}
+		})
+	}
+}
+
+func TestTunnel_SlowHandshake(t *testing.T) {
+	// server accepts tcp connections but never responds to the ssh handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Errorf("listen failed %v", err)
+		return
+	}
+	defer l.Close()
+	var mAccepts sync.Mutex
+	var accepted []net.Conn
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mAccepts.Lock()
+			accepted = append(accepted, conn)
+			mAccepts.Unlock()
+		}
+	}()
+	defer func() {
+		mAccepts.Lock()
+		for _, conn := range accepted {
+			conn.Close()
+		}
+		mAccepts.Unlock()
+	}()
+
+	tunnel, err := sshdb.New(&ssh.ClientConfig{User: "me", HostKeyCallback: ssh.InsecureIgnoreHostKey()}, l.Addr().String())
+	if err != nil {
+		t.Errorf("new tunnel failed %v", err)
+		return
+	}
+	defer tunnel.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	wg.Add(len(errs))
+	for i := range errs {
+		go func(idx int) {
+			defer wg.Done()
+			_, errs[idx] = tunnel.DialContext(ctx, "tcp", "localhost:3306")
+		}(i)
+	}
+	// ConnCount must not block on the handshake
+	cntDone := make(chan int)
+	go func() {
+		cntDone <- tunnel.ConnCount()
+	}()
+	select {
+	case <-cntDone:
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("ConnCount blocked during handshake")
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != context.DeadlineExceeded {
+			t.Errorf("dial %d expected context.DeadlineExceeded; got %v", i, err)
+		}
+	}
+	mAccepts.Lock()
+	if len(accepted) != 1 {
+		t.Errorf("expected a single handshake; got %d", len(accepted))
+	}
+	mAccepts.Unlock()
+}
+
 type deadlineKeyType struct{}
 
 var deadlineKey deadlineKeyType
@@ -433,20 +631,122 @@ func checkDeadlines(ctx context.Context, db00 *sql.DB, ignore bool) errlist {
 	if len(elx) != 3 {
 		retlist[0] = fmt.Errorf("expected errlist with len 3; got %d", len(elx))
 	}
+	// deadlines are emulated so setting a deadline never returns an error
 	for i, err := range elx {
-		if ignore {
-			if err != nil {
-				retlist[i] = fmt.Errorf("expected %s to return nil; got %v", deadlineType[i], err)
-			}
-			continue
-		}
-		if err == nil || err.Error() != "ssh: tcpChan: deadline not supported" {
-			retlist[i] = fmt.Errorf("expected %s to return ssh: tcpChan: deadline not supported; got %v", deadlineType[i], err)
+		if err != nil {
+			retlist[i] = fmt.Errorf("expected %s to return nil (ignore = %v); got %v", deadlineType[i], ignore, err)
 		}
 	}
 	return retlist
 }
 
+func TestSSHConn_Deadlines(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9239", "localhost:9240"
+	signer, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		key:    signer.PublicKey(),
+		userID: "me",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: getPublicKeyServerCfg("me", signer.PublicKey()),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+	tunnel, err := sshdb.New(ds.clientConfig(), ds.addr)
+	if err != nil {
+		t.Errorf("new tunnel failed %v", err)
+		return
+	}
+	defer tunnel.Close()
+
+	conn, err := tunnel.DialContext(context.Background(), "tcp", remoteDbAddr)
+	if err != nil {
+		t.Errorf("dial failed %v", err)
+		return
+	}
+	defer conn.Close()
+	buff := make([]byte, 128)
+
+	// mock db echoes only after receiving 128 bytes so read blocks until deadline
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := conn.Read(buff); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected read deadline exceeded; got %v", err)
+	}
+	var netErr net.Error
+	if _, err := conn.Read(buff); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected timeout net.Error on expired deadline; got %v", err)
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(-time.Second))
+	if _, err := conn.Write(buff); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected write deadline exceeded; got %v", err)
+	}
+
+	// channel must remain open after timeouts
+	_ = conn.SetDeadline(time.Time{})
+	copy(buff, "0123456789012345678901234567890123456789012345678901234567890123ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/")
+	if _, err := conn.Write(buff); err != nil {
+		t.Errorf("write after timeout failed %v", err)
+		return
+	}
+	result := make([]byte, 0, 128)
+	for len(result) < 128 {
+		n, err := conn.Read(buff[:7]) // small reads test buffering of background read
+		if err != nil {
+			t.Errorf("read after timeout failed %v", err)
+			return
+		}
+		result = append(result, buff[:n]...)
+	}
+	if !strings.HasPrefix(string(result), "0123456789") || !strings.HasSuffix(string(result), "+/") {
+		t.Errorf("unexpected echo %s", result)
+	}
+
+	// a read started without a deadline is interrupted by a later deadline
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(buff[:1])
+		readErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	_ = conn.SetDeadline(time.Date(1, 1, 1, 1, 1, 1, 1, time.UTC))
+	select {
+	case err := <-readErr:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected interrupted read deadline exceeded; got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("SetDeadline did not interrupt pending read")
+		return
+	}
+
+	// echoes are not read so a large write blocks until the deadline.  The
+	// next write waits for the timed out write to complete.
+	_ = conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Write(make([]byte, 64<<20)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected large write deadline exceeded; got %v", err)
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := conn.Write(buff); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected deadline exceeded while prior write pending; got %v", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+	if _, err := conn.Write(buff); err != nil {
+		t.Errorf("write after pending write completed failed %v", err)
+	}
+}
+
 func TestNewTunnel(t *testing.T) {
 	type args struct {
 		addr string
@@ -518,3 +818,104 @@ func getPasswordServerCfg(matchFunc func([]byte) bool) *ssh.ServerConfig {
 		},
 	}
 }
+
+func TestTunnel_SetMaxChannels(t *testing.T) {
+	remoteAddr, remoteDbAddr := "localhost:9259", "localhost:9260"
+	signer, serverSigner, err := getKeys()
+	if err != nil {
+		t.Errorf("unable to read keys - %v", err)
+		return
+	}
+	ds := &directTCPServer{
+		signer: serverSigner,
+		key:    signer.PublicKey(),
+		userID: "me",
+		addr:   remoteAddr,
+		laddr:  []string{remoteDbAddr},
+		srvcfg: getPublicKeyServerCfg("me", signer.PublicKey()),
+	}
+	srvCloseFunc, err := ds.start()
+	if err != nil {
+		t.Errorf("directTCPServer start %v", err)
+		return
+	}
+	defer srvCloseFunc()
+	tunnel, err := sshdb.New(ds.clientConfig(), ds.addr)
+	if err != nil {
+		t.Errorf("new tunnel failed %v", err)
+		return
+	}
+	defer tunnel.Close()
+	tunnel.SetMaxChannels(2)
+
+	ctx := context.Background()
+	conn0, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+	if err != nil {
+		t.Errorf("conn0 dial failed %v", err)
+		return
+	}
+	defer conn0.Close()
+	conn1, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+	if err != nil {
+		t.Errorf("conn1 dial failed %v", err)
+		return
+	}
+
+	// limit reached so dial waits until ctx is done
+	ctxTimeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if conn, err := tunnel.DialContext(ctxTimeout, "tcp", remoteDbAddr); err != context.DeadlineExceeded {
+		if err == nil {
+			conn.Close()
+		}
+		t.Errorf("expected context.DeadlineExceeded; got %v", err)
+	}
+
+	// queued dial completes after a connection closes
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	resultChan := make(chan dialResult, 1)
+	go func() {
+		conn, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+		resultChan <- dialResult{conn, err}
+	}()
+	select {
+	case r := <-resultChan:
+		t.Errorf("expected dial to wait; got %v", r.err)
+		if r.conn != nil {
+			r.conn.Close()
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+	conn1.Close()
+	select {
+	case r := <-resultChan:
+		if r.err != nil {
+			t.Errorf("queued dial failed %v", r.err)
+			break
+		}
+		if err := echoTest(r.conn); err != nil {
+			t.Errorf("echo %v", err)
+		}
+		r.conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Errorf("queued dial did not complete")
+	}
+
+	// no limit
+	tunnel.SetMaxChannels(0)
+	conns := make([]net.Conn, 0, 3)
+	for i := 0; i < 3; i++ {
+		conn, err := tunnel.DialContext(ctx, "tcp", remoteDbAddr)
+		if err != nil {
+			t.Errorf("unlimited dial %d failed %v", i, err)
+			break
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
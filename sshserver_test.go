@@ -58,6 +58,9 @@ type directTCPServer struct {
 	addr   string
 	laddr  []string
 	srvcfg *ssh.ServerConfig
+	// ignoreRequests leaves global requests unanswered to
+	// mimic an unresponsive server
+	ignoreRequests bool
 
 	//m  sync.Mutex
 	wg sync.WaitGroup
@@ -121,13 +124,20 @@ func (d *directTCPServer) start() (func(), error) {
 			}
 			// Before use, a handshake must be performed on the incoming net.Conn.
 			//sshConn
-			_, chans, reqs, err := ssh.NewServerConn(socketConn, config)
+			sconn, chans, reqs, err := ssh.NewServerConn(socketConn, config)
 			if err != nil {
 				continue
 			}
 
-			// Discard all global out-of-band Requests
-			go ssh.DiscardRequests(reqs)
+			// handle tcpip-forward requests and discard all other global out-of-band Requests
+			if d.ignoreRequests {
+				go func() {
+					for range reqs {
+					}
+				}()
+			} else {
+				go d.handleRequests(sconn, reqs)
+			}
 
 			// Accept all channels
 			go d.handleChannels(chans)
@@ -262,3 +272,90 @@ func mockDBPingHandler(conn net.Conn) {
 		bcnt = 0
 	}
 }
+
+// RFC4254 7.1
+type tcpipForwardPayload struct {
+	Addr string
+	Port uint32
+}
+
+// RFC4254 7.2
+type forwardedTCPPayload struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// handleRequests listens on the requested address for each tcpip-forward request and
+// opens a forwarded-tcpip channel to the client for each accepted connection.  Listeners
+// are closed on cancel-tcpip-forward or when the connection ends.
+func (d *directTCPServer) handleRequests(sconn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := make(map[string]net.Listener)
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for req := range reqs {
+		var payload tcpipForwardPayload
+		if req.Type != "tcpip-forward" && req.Type != "cancel-tcpip-forward" ||
+			ssh.Unmarshal(req.Payload, &payload) != nil {
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+			continue
+		}
+		addr := net.JoinHostPort(payload.Addr, fmt.Sprintf("%d", payload.Port))
+		if req.Type == "cancel-tcpip-forward" {
+			if l, ok := listeners[addr]; ok {
+				l.Close()
+				delete(listeners, addr)
+			}
+			_ = req.Reply(true, nil)
+			continue
+		}
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		listeners[addr] = l
+		_ = req.Reply(true, nil)
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go forwardConn(sconn, payload, conn)
+			}
+		}()
+	}
+}
+
+func forwardConn(sconn *ssh.ServerConn, payload tcpipForwardPayload, conn net.Conn) {
+	defer conn.Close()
+	origin := conn.RemoteAddr().(*net.TCPAddr)
+	ch, reqs, err := sconn.OpenChannel("forwarded-tcpip", ssh.Marshal(forwardedTCPPayload{
+		Addr:       payload.Addr,
+		Port:       payload.Port,
+		OriginAddr: origin.IP.String(),
+		OriginPort: uint32(origin.Port),
+	}))
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	go ssh.DiscardRequests(reqs)
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(ch, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, ch)
+		done <- struct{}{}
+	}()
+	<-done
+}
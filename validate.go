@@ -0,0 +1,131 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// errValidateDial is returned by the dialer passed to drivers during
+// validation so that no connection is attempted
+var errValidateDial = errors.New("sshdb: validate does not dial")
+
+// Validate checks the config without connecting to any host or modifying the
+// config.  Field values, key, certificate and known hosts files, and each
+// datasource's driver and dsn are checked.  Secret placeholders are checked for
+// form but not resolved, so no cmd helper or SecretResolver is called; a client
+// key or dsn containing placeholders is therefore not parsed.  The dsn is
+// checked by the driver's ValidateDSN method if it is a DSNValidator, otherwise
+// by passing it to the driver's OpenConnector with a dialer that always fails.
+// Rather than stopping at the first problem, Validate returns a ConfigErrors
+// listing every problem found or nil if the config is valid.  Use errors.Is to
+// test for an ErrorCode.
+//
+//	if err := tc.Validate(); err != nil {
+//		for _, ce := range err.(sshdb.ConfigErrors) {
+//			log.Printf("%s: %s", ce.Path, ce.Msg)
+//		}
+//	}
+func (tc *TunnelConfig) Validate() error {
+	tc.m.Lock()
+	defer tc.m.Unlock()
+	errs := tc.validateErrors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateErrors collects all errors for the TunnelConfig.  Routines must
+// obtain a lock on tc.m prior to calling.
+func (tc *TunnelConfig) validateErrors() ConfigErrors {
+	rc, err := tc.resolvedConfig()
+	if err != nil {
+		return ConfigErrors{err.(*ConfigError)}
+	}
+	errs := rc.fieldErrors()
+	errs = append(errs, rc.hostErrors()...)
+	for i, jh := range rc.JumpHosts {
+		errs = append(errs, jh.tunnelConfig(rc.StrictHostKeyChecking, i).hostErrors()...)
+	}
+	return append(errs, rc.datasourceErrors()...)
+}
+
+// hostErrors checks the secrets and the key, certificate and known hosts
+// values of a host
+func (tc *TunnelConfig) hostErrors() ConfigErrors {
+	secrets, errs := tc.secretErrors()
+	if len(errs) == 0 && secrets != nil {
+		if _, err := tc.clientSigners(secrets); err != nil {
+			errs = append(errs, err.(*ConfigError))
+		}
+	}
+	if _, err := tc.caKeys(); err != nil {
+		errs = append(errs, err.(*ConfigError))
+	}
+	if _, err := tc.fixedHostKey(); err != nil {
+		errs = append(errs, err.(*ConfigError))
+	}
+	if tc.KnownHostsFile > "" {
+		if _, err := KnownHostsCallback(tc.KnownHostsFile, tc.TrustOnFirstUse); err != nil {
+			errs = append(errs, tc.newErr(ErrKnownHosts, "known_hosts_file", "", fmt.Sprintf("known hosts file %s error: %v", tc.KnownHostsFile, err)).setErr(err))
+		}
+	}
+	return errs
+}
+
+// datasourceErrors checks the dsn and driver of each datasource
+func (tc *TunnelConfig) datasourceErrors() ConfigErrors {
+	var errs ConfigErrors
+	names := make([]string, 0, len(tc.Datasources))
+	for nm := range tc.Datasources {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	dialer := DialerFunc(func(context.Context, string, string) (net.Conn, error) {
+		return nil, errValidateDial
+	})
+	for _, nm := range names {
+		dataSource := tc.Datasources[nm]
+		dsn := dataSource.ConnectionString
+		if dsn == "" {
+			errs = append(errs, tc.newErr(ErrEmptyDSN, "datasources."+nm+".dsn", dsn, fmt.Sprintf("%s db has empty datasourcename", nm)))
+			continue
+		}
+		hasSecrets, err := checkSecrets(dsn)
+		if err != nil {
+			errs = append(errs, tc.newErr(ErrSecret, "datasources."+nm+".dsn", dsn, fmt.Sprintf("[%s] dsn secret error: %v", nm, err)).setErr(err))
+		}
+		tunnelDriver, derr := dataSource.Driver()
+		if derr != nil {
+			errs = append(errs, tc.newErr(ErrDriver, "datasources."+nm+".driver_name", dsn, fmt.Sprintf("[%s] invalid driver %s - %v", nm, dataSource.DriverName, derr)).setErr(derr))
+		}
+		if err != nil || derr != nil {
+			continue
+		}
+		if ce := tc.connectorOptionsErr(nm, dataSource, tunnelDriver); ce != nil {
+			errs = append(errs, ce)
+			continue
+		}
+		if hasSecrets {
+			// the dsn may not be parsed without its secrets
+			continue
+		}
+		if dv, ok := tunnelDriver.(DSNValidator); ok {
+			err = dv.ValidateDSN(dsn)
+		} else {
+			_, err = openConnector(tunnelDriver, dialer, dsn, dataSource.ConnectorOptions)
+		}
+		if err != nil {
+			errs = append(errs, tc.newErr(ErrOpenConnector, "datasources."+nm+".dsn", dsn, fmt.Sprintf("[%s] %s openconnector error: %v", nm, dataSource.DriverName, err)).setErr(err))
+		}
+	}
+	return errs
+}
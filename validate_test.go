@@ -0,0 +1,169 @@
+// Copyright 2021 James Cote
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sshdb_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jfcote87/sshdb"
+	"github.com/jfcote87/sshdb/internal"
+)
+
+func TestTunnelConfig_Validate(t *testing.T) {
+	sshdb.RegisterDriver("test_driver", testDriver)
+	tc, err := internal.LoadTunnelConfig("testfiles/validate/invalid.yaml")
+	if err != nil {
+		t.Fatalf("LoadTunnelConfig %v", err)
+	}
+	want := []struct {
+		code sshdb.ErrorCode
+		path string
+	}{
+		{code: sshdb.ErrNoUser, path: "user_id"},
+		{code: sshdb.ErrNoAddress, path: "jump_hosts[0].hostport"},
+		{code: sshdb.ErrForwardAddress, path: "forwards.pg"},
+		{code: sshdb.ErrKeyParse, path: "client_key"},
+		{code: sshdb.ErrServerKeyParse, path: "server_public_key"},
+		{code: sshdb.ErrCAKeyParse, path: "jump_hosts[0].server_ca_keys[0]"},
+		{code: sshdb.ErrOpenConnector, path: "datasources.a.dsn"},
+		{code: sshdb.ErrDriver, path: "datasources.b.driver_name"},
+		{code: sshdb.ErrEmptyDSN, path: "datasources.c.dsn"},
+		{code: sshdb.ErrSecret, path: "datasources.d.dsn"},
+	}
+	err = tc.Validate()
+	var errs sshdb.ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ConfigErrors; got %v", err)
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors; got %d: %v", len(want), len(errs), err)
+	}
+	for i, w := range want {
+		if errs[i].Code() != w.code || errs[i].Path != w.path {
+			t.Errorf("error %d expected %d %s; got %d %s", i, w.code, w.path, errs[i].Code(), errs[i].Path)
+		}
+		if !errors.Is(err, w.code) {
+			t.Errorf("errors.Is(err, %d) = false", w.code)
+		}
+	}
+	if errors.Is(err, sshdb.ErrNoAuthMethod) {
+		t.Errorf("errors.Is(err, ErrNoAuthMethod) expected false")
+	}
+	var ce *sshdb.ConfigError
+	if !errors.As(err, &ce) || ce.Code() != sshdb.ErrNoUser {
+		t.Errorf("expected first ConfigError to be ErrNoUser; got %v", ce)
+	}
+	// As is used by errors.As prior to Go 1.20
+	ce = nil
+	if !errs.As(&ce) || ce.Code() != sshdb.ErrNoUser {
+		t.Errorf("expected ConfigErrors.As to find ErrNoUser; got %v", ce)
+	}
+
+	// the first structural error is returned when opening
+	if _, err := tc.DatabaseMap(); !errors.Is(err, sshdb.ErrNoUser) {
+		t.Errorf("DatabaseMap expected ErrNoUser; got %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	sshdb.RegisterDriver("test_driver", testDriver)
+	cfg, err := internal.LoadConfig("testfiles/multi/config.yaml")
+	if err != nil {
+		t.Fatalf("LoadConfig %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected valid config; got %v", err)
+	}
+	cfg.Tunnels["west"].Datasources["inventory"] = sshdb.Datasource{DriverName: "test_driver", ConnectionString: "ERR"}
+	cfg.Tunnels["west"].UserID = ""
+	err = cfg.Validate()
+	var errs sshdb.ConfigErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected 2 ConfigErrors; got %v", err)
+	}
+	for i, path := range []string{"tunnels.west.user_id", "tunnels.west.datasources.inventory.dsn"} {
+		if errs[i].Path != path {
+			t.Errorf("error %d expected path %s; got %s", i, path, errs[i].Path)
+		}
+	}
+	if !errors.Is(err, sshdb.ErrOpenConnector) {
+		t.Errorf("expected ErrOpenConnector; got %v", err)
+	}
+}
+
+func TestTunnelConfig_ValidateNoSideEffects(t *testing.T) {
+	sshdb.RegisterDriver("test_driver", testDriver)
+	fn := filepath.Join(t.TempDir(), "ran")
+	resolved := false
+	sshdb.RegisterSecretResolver("validate_test", sshdb.SecretResolverFunc(func(ref string) (string, error) {
+		resolved = true
+		return ref, nil
+	}))
+	tc := &sshdb.TunnelConfig{
+		HostPort:     "localhost:9263",
+		UserID:       "me",
+		Pwd:          "${cmd:touch " + fn + "}",
+		ClientKey:    "${validate_test:key}",
+		ClientKeyPwd: "${env:}",
+		Datasources: map[string]sshdb.Datasource{
+			"db": {DriverName: "test_driver", ConnectionString: "${env:SSHDB_VALIDATE_UNSET}:9262"},
+		},
+	}
+	err := tc.Validate()
+	var errs sshdb.ConfigErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Code() != sshdb.ErrSecret || errs[0].Path != "client_key_pwd" {
+		t.Errorf("expected a single ErrSecret for client_key_pwd; got %v", err)
+	}
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("expected cmd secret not to run; got %v", err)
+	}
+	if resolved {
+		t.Errorf("expected secret resolver not to be called")
+	}
+}
+
+// validatingDriver fails the test if Validate opens a connector
+type validatingDriver struct {
+	t *testing.T
+}
+
+func (vd validatingDriver) Name() string {
+	return "validating_driver"
+}
+
+func (vd validatingDriver) OpenConnector(sshdb.Dialer, string) (driver.Connector, error) {
+	vd.t.Errorf("expected Validate to call ValidateDSN rather than OpenConnector")
+	return nil, errors.New("unexpected OpenConnector call")
+}
+
+func (vd validatingDriver) ValidateDSN(dsn string) error {
+	if dsn == "bad_dsn" {
+		return errors.New("invalid dsn")
+	}
+	return nil
+}
+
+func TestTunnelConfig_ValidateDSN(t *testing.T) {
+	sshdb.RegisterDriver("validating_driver", validatingDriver{t})
+	tc := &sshdb.TunnelConfig{
+		HostPort: "localhost:9263",
+		UserID:   "me",
+		Pwd:      "pwd",
+		Datasources: map[string]sshdb.Datasource{
+			"bad":  {DriverName: "validating_driver", ConnectionString: "bad_dsn"},
+			"good": {DriverName: "validating_driver", ConnectionString: "good_dsn"},
+		},
+	}
+	err := tc.Validate()
+	var errs sshdb.ConfigErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Code() != sshdb.ErrOpenConnector || errs[0].Path != "datasources.bad.dsn" {
+		t.Errorf("expected a single ErrOpenConnector for datasources.bad.dsn; got %v", err)
+	}
+}